@@ -5,6 +5,9 @@ package main
 import (
 	"backend-project/data" 
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,13 +15,28 @@ import (
 	"github.com/gorilla/mux" 
 )
 
-// ViewAllTicketsHandler displays all existing tickets without fetching their associated messages
-func ViewAllTicketsHandler(w http.ResponseWriter, r *http.Request) {
+// ViewAllTicketsHandler displays all existing tickets, most urgent and oldest first, without fetching their associated messages.
+// The ?assignee= query parameter limits the list to one operator's tickets, or to unassigned tickets with ?assignee=none.
+func (app *application) ViewAllTicketsHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Viewing all tickets...")
 
-	// Fetch all tickets from the database
-	tickets, err := data.GetTickets()
+	// Fetch the tickets from the database
+	var tickets []data.Ticket
+	var err error
+	switch assignee := r.URL.Query().Get("assignee"); assignee {
+	case "":
+		tickets, err = app.store.GetTickets()
+	case "none":
+		tickets, err = app.store.GetTicketsByAssignee(0)
+	default:
+		assigneeID, parseErr := strconv.ParseInt(assignee, 10, 64)
+		if parseErr != nil || assigneeID <= 0 {
+			http.Error(w, "Invalid assignee", http.StatusBadRequest)
+			return
+		}
+		tickets, err = app.store.GetTicketsByAssignee(assigneeID)
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch tickets.", http.StatusInternalServerError)
 		return
@@ -30,7 +48,7 @@ func ViewAllTicketsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // AdminGetTicketByIDHandler handles requests to retrieve a specific ticket by its ID along with its conversations.
-func AdminGetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) AdminGetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Getting ticket by ID...")
 
@@ -43,14 +61,14 @@ func AdminGetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get ticket details by ID
-	ticket, err := data.GetTicketByID(ticketID)
+	ticket, err := app.store.GetTicketByID(ticketID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
 		return
 	}
 
 	// Get conversations for the ticket
-	conversations, err := data.GetConversationsByTicketID(ticketID)
+	conversations, err := app.store.GetConversationsByTicketID(ticketID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve conversations", http.StatusInternalServerError)
 		return
@@ -74,7 +92,7 @@ func AdminGetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // AdminAddConversationHandler adds a conversation to a ticket for admin users
-func AdminAddConversationHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) AdminAddConversationHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Adding conversation...")
 
@@ -95,11 +113,22 @@ func AdminAddConversationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Make sure the ticket exists before replying to it
+	if _, err := app.store.GetTicketByID(ticketID); err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to retrieve ticket:", err)
+		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
+		return
+	}
+
 	// Ensure that the sender is always "operator" for admin users
 	sender := "operator"
 
-	// Add the conversation to the database
-	conversationID, err := data.AddConversation(ticketID, sender, conversation.Message)
+	// Add the conversation to the database, recording which operator sent it
+	conversationID, err := app.store.AddConversation(ticketID, int64(principalFrom(r).UserID), sender, conversation.Message)
 	if err != nil {
 		log.Println("Failed to add conversation to ticket:", err)
 		http.Error(w, "Failed to add conversation to ticket", http.StatusInternalServerError)
@@ -113,3 +142,278 @@ func AdminAddConversationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// AdminUpdateTicketStatusHandler changes the status of any ticket for admin users
+func (app *application) AdminUpdateTicketStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Updating ticket status...")
+
+	// Extract ticketID from request URL
+	params := mux.Vars(r)
+	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body to get the new status
+	var request struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	// Get ticket details by ID
+	ticket, err := app.store.GetTicketByID(ticketID)
+	if err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
+		return
+	}
+
+	if !app.changeTicketStatus(w, ticket, request.Status, int64(principalFrom(r).UserID), true) {
+		return
+	}
+
+	// Respond with the new status
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticketID": ticketID,
+		"status":   request.Status,
+	})
+}
+
+// AdminUpdateTicketPriorityHandler changes the priority and severity of a ticket for admin users
+func (app *application) AdminUpdateTicketPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Updating ticket priority...")
+
+	// Extract ticketID from request URL
+	params := mux.Vars(r)
+	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body; fields that are left out keep their current value
+	var request struct {
+		Priority *string `json:"priority"`
+		Severity *string `json:"severity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	// Get ticket details by ID
+	ticket, err := app.store.GetTicketByID(ticketID)
+	if err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
+		return
+	}
+
+	priority := ticket.Priority
+	if request.Priority != nil {
+		priority = *request.Priority
+	}
+	var severity string
+	if ticket.Severity != nil {
+		severity = *ticket.Severity
+	}
+	if request.Severity != nil {
+		severity = *request.Severity
+	}
+
+	if !data.ValidTicketPriority(priority) {
+		http.Error(w, fmt.Sprintf("Invalid ticket priority %q", priority), http.StatusBadRequest)
+		return
+	}
+	if !data.ValidTicketSeverity(severity) {
+		http.Error(w, fmt.Sprintf("Invalid ticket severity %q", severity), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.store.UpdateTicketPriority(ticketID, priority, severity); err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to update ticket priority:", err)
+		http.Error(w, "Failed to update ticket priority", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with the new priority and severity
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticketID": ticketID,
+		"priority": priority,
+		"severity": severity,
+	})
+}
+
+// MyTicketsHandler displays the tickets assigned to the admin making the request
+func (app *application) MyTicketsHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Viewing assigned tickets...")
+
+	// Fetch the tickets assigned to the operator
+	tickets, err := app.store.GetTicketsByAssignee(int64(principalFrom(r).UserID))
+	if err != nil {
+		http.Error(w, "Failed to fetch tickets.", http.StatusInternalServerError)
+		return
+	}
+
+	// Serialize tickets to JSON and send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tickets)
+}
+
+// AssignTicketHandler assigns an unassigned ticket to an operator. Without a
+// userId in the request body the ticket is assigned to the admin making the request.
+func (app *application) AssignTicketHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Assigning ticket...")
+	app.updateTicketAssignee(w, r, "assign")
+}
+
+// ReassignTicketHandler moves an assigned ticket to another operator
+func (app *application) ReassignTicketHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Reassigning ticket...")
+	app.updateTicketAssignee(w, r, "reassign")
+}
+
+// UnassignTicketHandler removes the operator a ticket is assigned to
+func (app *application) UnassignTicketHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Unassigning ticket...")
+	app.updateTicketAssignee(w, r, "unassign")
+}
+
+// updateTicketAssignee implements the assign, reassign and unassign endpoints
+func (app *application) updateTicketAssignee(w http.ResponseWriter, r *http.Request, action string) {
+	// Extract ticketID from request URL
+	params := mux.Vars(r)
+	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	// Work out who the ticket should be assigned to
+	var assigneeID int64
+	if action != "unassign" {
+		var request struct {
+			UserID int64 `json:"userId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		assigneeID = request.UserID
+		if assigneeID == 0 {
+			assigneeID = int64(principalFrom(r).UserID)
+		}
+
+		// Only active staff can be assigned tickets
+		assignee, err := app.store.GetUserByID(int(assigneeID))
+		if err != nil && !errors.Is(err, data.ErrUserNotFound) {
+			log.Println("Failed to retrieve assignee:", err)
+			http.Error(w, "Failed to retrieve user information", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !data.StaffRole(assignee.Role) || assignee.DeactivatedAt != nil {
+			http.Error(w, "Tickets can only be assigned to operators", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get ticket details by ID
+	ticket, err := app.store.GetTicketByID(ticketID)
+	if err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
+		return
+	}
+
+	var currentID int64
+	if ticket.AssignedTo != nil {
+		currentID = *ticket.AssignedTo
+	}
+	switch {
+	case action == "assign" && currentID != 0:
+		http.Error(w, "Ticket is already assigned. Reassign it instead", http.StatusConflict)
+		return
+	case action != "assign" && currentID == 0:
+		http.Error(w, "Ticket is not assigned", http.StatusConflict)
+		return
+	case action == "reassign" && currentID == assigneeID:
+		http.Error(w, "Ticket is already assigned to this operator", http.StatusConflict)
+		return
+	}
+
+	if err := app.store.AssignTicket(ticketID, currentID, assigneeID); err != nil {
+		if errors.Is(err, data.ErrTicketAssigneeChanged) {
+			http.Error(w, "Ticket assignment was changed by someone else, please try again", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to update ticket assignee:", err)
+		http.Error(w, "Failed to update ticket assignee", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with the new assignee; null when unassigned
+	response := map[string]interface{}{
+		"ticketID":   ticketID,
+		"assignedTo": nil,
+	}
+	if assigneeID != 0 {
+		response["assignedTo"] = assigneeID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PurgeTicketHandler permanently deletes a ticket and its conversations (admin only)
+func (app *application) PurgeTicketHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Purging ticket...")
+
+	// Extract ticketID from request URL
+	params := mux.Vars(r)
+	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	// Delete the ticket and its conversations
+	if err := app.store.PurgeTicket(ticketID); err != nil {
+		if errors.Is(err, data.ErrTicketNotFound) {
+			http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to purge ticket:", err)
+		http.Error(w, "Failed to purge ticket", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with success message
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Ticket %d permanently deleted", ticketID)
+}
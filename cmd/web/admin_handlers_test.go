@@ -0,0 +1,131 @@
+// admin_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestTicketAssignment(t *testing.T) {
+	app, store := newTestApp(t)
+	supervisorID, supervisorToken := registerStaff(t, app, "supervisor@example.com", data.RoleSupervisor)
+	agentID, agentToken := registerStaff(t, app, "agent@example.com", data.RoleAgent)
+	customerID := registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	ticketID := createTicket(t, app, customerToken)
+	path := fmt.Sprintf("/admin/tickets/%d", ticketID)
+
+	tests := []struct {
+		name   string
+		action string
+		body   interface{}
+		token  string
+		status int
+		want   int64
+	}{
+		{"agents cannot assign tickets", "assign", nil, agentToken, http.StatusForbidden, 0},
+		{"unassigning an unassigned ticket", "unassign", nil, supervisorToken, http.StatusConflict, 0},
+		{"customers cannot be assignees", "assign", map[string]int{"userId": customerID}, supervisorToken, http.StatusBadRequest, 0},
+		{"assign to oneself without a body", "assign", nil, supervisorToken, http.StatusOK, int64(supervisorID)},
+		{"assigning an assigned ticket", "assign", map[string]int{"userId": agentID}, supervisorToken, http.StatusConflict, int64(supervisorID)},
+		{"reassign to the same operator", "reassign", map[string]int{"userId": supervisorID}, supervisorToken, http.StatusConflict, int64(supervisorID)},
+		{"reassign to another operator", "reassign", map[string]int{"userId": agentID}, supervisorToken, http.StatusOK, int64(agentID)},
+		{"unassign", "unassign", nil, supervisorToken, http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		w := request(t, app, http.MethodPost, path+"/"+tt.action, tt.body, tt.token)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+		ticket, err := store.GetTicketByID(ticketID)
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		var assignee int64
+		if ticket.AssignedTo != nil {
+			assignee = *ticket.AssignedTo
+		}
+		if assignee != tt.want {
+			t.Errorf("%s: assigned to %d, want %d", tt.name, assignee, tt.want)
+		}
+	}
+
+	if w := request(t, app, http.MethodPost, "/admin/tickets/999/assign", nil, supervisorToken); w.Code != http.StatusNotFound {
+		t.Errorf("unknown ticket: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Operators see the tickets assigned to them, and the list can be filtered
+	if w := request(t, app, http.MethodPost, path+"/assign", map[string]int{"userId": agentID}, supervisorToken); w.Code != http.StatusOK {
+		t.Fatalf("assign: status %d: %s", w.Code, w.Body.String())
+	}
+	createTicket(t, app, customerToken)
+
+	lists := []struct {
+		path  string
+		token string
+		count int
+	}{
+		{"/admin/tickets/mine", agentToken, 1},
+		{"/admin/tickets/mine", supervisorToken, 0},
+		{"/admin/tickets", agentToken, 2},
+		{fmt.Sprintf("/admin/tickets?assignee=%d", agentID), supervisorToken, 1},
+		{"/admin/tickets?assignee=none", supervisorToken, 1},
+	}
+	for _, l := range lists {
+		w := request(t, app, http.MethodGet, l.path, nil, l.token)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", l.path, w.Code)
+			continue
+		}
+		var tickets []data.Ticket
+		if err := json.Unmarshal(w.Body.Bytes(), &tickets); err != nil {
+			t.Fatalf("%s: decoding tickets: %v", l.path, err)
+		}
+		if len(tickets) != l.count {
+			t.Errorf("%s: %d tickets, want %d", l.path, len(tickets), l.count)
+		}
+	}
+	if w := request(t, app, http.MethodGet, "/admin/tickets?assignee=abc", nil, supervisorToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid assignee: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAdminAddConversationHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	agentID, agentToken := registerStaff(t, app, "agent@example.com", data.RoleAgent)
+	registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	ticketID := createTicket(t, app, customerToken)
+	message := map[string]string{"message": "On it"}
+
+	path := fmt.Sprintf("/admin/tickets/%d/conversation", ticketID)
+	if w := request(t, app, http.MethodPost, path, message, customerToken); w.Code != http.StatusForbidden {
+		t.Errorf("customer: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Replies record the operator who sent them
+	w := request(t, app, http.MethodPost, path, message, agentToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reply: status %d: %s", w.Code, w.Body.String())
+	}
+	conversations, err := store.GetConversationsByTicketID(ticketID)
+	if err != nil {
+		t.Fatalf("GetConversationsByTicketID: %v", err)
+	}
+	c := conversations[len(conversations)-1]
+	if c.Message != "On it" || c.Sender != "operator" || c.SenderID == nil || *c.SenderID != int64(agentID) {
+		t.Errorf("reply %q sent by %q (%v), want operator %d", c.Message, c.Sender, c.SenderID, agentID)
+	}
+
+	// Replies to tickets that do not exist are not stored
+	if w := request(t, app, http.MethodPost, "/admin/tickets/999/conversation", message, agentToken); w.Code != http.StatusNotFound {
+		t.Errorf("unknown ticket: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if conversations, _ := store.GetConversationsByTicketID(999); len(conversations) != 0 {
+		t.Errorf("a reply was stored for an unknown ticket")
+	}
+}
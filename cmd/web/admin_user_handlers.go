@@ -0,0 +1,570 @@
+// admin_user_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Page sizes of the user list
+const (
+	defaultUsersPerPage = 20
+	maxUsersPerPage     = 100
+)
+
+// maxImpersonationReasonLength is the longest reason accepted for an
+// impersonation; it is stored in the 255-character details of its security event
+const maxImpersonationReasonLength = 180
+
+// adminUser is a user as returned to administrators
+type adminUser struct {
+	userProfile
+	Status        string
+	DeactivatedAt *time.Time `json:",omitempty"`
+}
+
+// newAdminUser returns the administrator's view of a user
+func newAdminUser(user *data.User) adminUser {
+	return adminUser{
+		userProfile:   newUserProfile(user),
+		Status:        user.Status(),
+		DeactivatedAt: user.DeactivatedAt,
+	}
+}
+
+// recordAdminAction records a security event for an action an administrator
+// took on a user, with the ID of the administrator. Failures are logged; the
+// error is returned for actions that must not go ahead without a record.
+func (app *application) recordAdminAction(r *http.Request, userID int, eventType, details string) error {
+	adminID := principalFrom(r).UserID
+	log.Printf("Administrator %d: %s on user %d: %s", adminID, eventType, userID, details)
+	return app.saveSecurityEvent(r, &data.SecurityEvent{
+		UserID:  userID,
+		Type:    eventType,
+		Details: details,
+		ActorID: &adminID,
+	})
+}
+
+// targetUser loads the user named in the request URL. It writes the error
+// response and returns false when there is no such user.
+func (app *application) targetUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	// Extract userID from request URL
+	userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := app.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Println("Error retrieving user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// refuseOwnAccount refuses an action administrators may not take on their
+// own account, so that they cannot lock themselves out
+func refuseOwnAccount(w http.ResponseWriter, r *http.Request, user *data.User, message string) bool {
+	if user.ID != principalFrom(r).UserID {
+		return false
+	}
+	http.Error(w, message, http.StatusForbidden)
+	return true
+}
+
+// revokeUserSessions revokes every session of a user and drops them from the
+// revocation cache, so that their access and refresh tokens stop working at
+// once. It returns the number of sessions revoked.
+func (app *application) revokeUserSessions(userID int, at time.Time) (int, error) {
+	revoked, err := app.store.RevokeOtherSessions(userID, 0, at)
+	if err != nil {
+		return 0, err
+	}
+	app.revocations.forgetUser(userID)
+	return revoked, nil
+}
+
+// ListUsersHandler lists the users a page at a time. ?q= searches the email
+// addresses and names, ?role= and ?status= filter, and ?page= and ?perPage=
+// pick the page.
+func (app *application) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Listing users...")
+
+	query := r.URL.Query()
+	filter := data.UserFilter{
+		Search: query.Get("q"),
+		Role:   query.Get("role"),
+		Status: query.Get("status"),
+	}
+	if filter.Role != "" && !data.ValidRole(filter.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	if filter.Status != "" && !data.ValidUserStatus(filter.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	if value := query.Get("page"); value != "" {
+		var err error
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+	}
+	perPage := defaultUsersPerPage
+	if value := query.Get("perPage"); value != "" {
+		var err error
+		if perPage, err = strconv.Atoi(value); err != nil || perPage < 1 || perPage > maxUsersPerPage {
+			http.Error(w, fmt.Sprintf("perPage must be between 1 and %d", maxUsersPerPage), http.StatusBadRequest)
+			return
+		}
+	}
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	users, total, err := app.store.ListUsers(filter)
+	if err != nil {
+		log.Println("Error listing users:", err)
+		http.Error(w, "Failed to fetch users.", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]adminUser, 0, len(users))
+	for i := range users {
+		views = append(views, newAdminUser(&users[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":   views,
+		"page":    page,
+		"perPage": perPage,
+		"total":   total,
+	})
+}
+
+// GetUserHandler returns one user
+func (app *application) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Getting user by ID...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// DeactivateUserHandler stops a user from logging in and signs them out of
+// every session
+func (app *application) DeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Deactivating user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if refuseOwnAccount(w, r, user, "Administrators cannot deactivate their own account") {
+		return
+	}
+	if user.DeactivatedAt != nil {
+		http.Error(w, "User is already deactivated", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	if err := app.store.SetUserDeactivated(user.ID, &now); err != nil {
+		log.Println("Error deactivating user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	revoked, err := app.revokeUserSessions(user.ID, now)
+	if err != nil {
+		log.Println("Error revoking sessions:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventAccountDeactivated,
+		fmt.Sprintf("The account was deactivated and %d sessions were revoked", revoked))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User deactivated successfully",
+		"revoked": revoked,
+	})
+}
+
+// ReactivateUserHandler lets a deactivated user log in again
+func (app *application) ReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Reactivating user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.DeactivatedAt == nil {
+		http.Error(w, "User is not deactivated", http.StatusConflict)
+		return
+	}
+
+	if err := app.store.SetUserDeactivated(user.ID, nil); err != nil {
+		log.Println("Error reactivating user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventAccountReactivated, "The account was reactivated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User reactivated successfully",
+	})
+}
+
+// ForceLogoutUserHandler revokes every session of a user
+func (app *application) ForceLogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Logging user out everywhere...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := app.revokeUserSessions(user.ID, time.Now())
+	if err != nil {
+		log.Println("Error revoking sessions:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventForcedLogout,
+		fmt.Sprintf("%d sessions were revoked", revoked))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User logged out of every session",
+		"revoked": revoked,
+	})
+}
+
+// ResendVerificationHandler emails a new account verification PIN to a user
+// who has not verified their account yet
+func (app *application) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Resending verification PIN...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.UserActive == 1 {
+		http.Error(w, "User is already verified", http.StatusConflict)
+		return
+	}
+
+	pin, err := app.issuePin(user.ID, data.PinPurposeAccount)
+	if err != nil {
+		if writePinCooldown(w, err) {
+			return
+		}
+		log.Println("Error generating pin number:", err)
+		http.Error(w, "Error generating pin number", http.StatusInternalServerError)
+		return
+	}
+	if err := sendPinByEmail(user.Email, pin); err != nil {
+		log.Println("Error sending PIN via email:", err)
+		http.Error(w, "Error sending PIN via email", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventVerificationResent, "A new verification PIN was emailed")
+
+	response := map[string]interface{}{"message": "Verification PIN sent"}
+	if app.echoPins {
+		response["pin"] = pin
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteUserHandler deletes a user. Their tickets and messages are kept.
+func (app *application) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Deleting user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if refuseOwnAccount(w, r, user, "Administrators cannot delete their own account") {
+		return
+	}
+
+	if err := app.store.DeleteUser(user.ID); err != nil {
+		if errors.Is(err, data.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Println("Error deleting user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	app.revocations.forgetUser(user.ID)
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventUserDeleted,
+		fmt.Sprintf("The user %s was deleted", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User deleted successfully",
+	})
+}
+
+// UnlockUserHandler lifts the lock placed on an account after too many failed
+// logins and forgets its failed attempts
+func (app *application) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Unlocking user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.ClearLoginFailures(user.Email); err != nil {
+		log.Println("Error clearing failed logins:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAdminAction(r, user.ID, data.SecurityEventAccountUnlocked, "Failed logins were cleared")
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User unlocked successfully",
+	})
+}
+
+// ListRolesHandler lists the roles users can have and the permissions each grants
+func (app *application) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Listing roles...")
+
+	type role struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+	}
+	roles := make([]role, 0, len(data.Roles))
+	for _, name := range data.Roles {
+		roles = append(roles, role{Name: name, Permissions: rolePermissions[name]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// SetUserRoleHandler changes the role of a user
+func (app *application) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Changing user role...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !data.ValidRole(request.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	app.changeUserRole(w, r, user, request.Role)
+}
+
+// PromoteUserHandler gives a user the next more privileged role
+func (app *application) PromoteUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Promoting user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	next := roleIndex(user.Role) + 1
+	if next >= len(data.Roles) {
+		http.Error(w, "User already has the most privileged role", http.StatusConflict)
+		return
+	}
+	app.changeUserRole(w, r, user, data.Roles[next])
+}
+
+// DemoteUserHandler gives a user the next less privileged role
+func (app *application) DemoteUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Demoting user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	previous := roleIndex(user.Role) - 1
+	if previous < 0 {
+		http.Error(w, "User already has the least privileged role", http.StatusConflict)
+		return
+	}
+	app.changeUserRole(w, r, user, data.Roles[previous])
+}
+
+// roleIndex returns the position of a role in data.Roles, counting unknown
+// roles as customers
+func roleIndex(role string) int {
+	for i, r := range data.Roles {
+		if r == role {
+			return i
+		}
+	}
+	return 0
+}
+
+// changeUserRole gives a user a new role and responds with it. The sessions
+// of the user are revoked, so that no token still carries the old role.
+func (app *application) changeUserRole(w http.ResponseWriter, r *http.Request, user *data.User, role string) {
+	// Administrators cannot lock themselves out by demoting their own account
+	if refuseOwnAccount(w, r, user, "Administrators cannot change their own role") {
+		return
+	}
+
+	revoked := 0
+	if user.Role != role {
+		if err := app.store.SetUserRole(user.ID, role); err != nil {
+			log.Println("Error changing user role:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		var err error
+		if revoked, err = app.revokeUserSessions(user.ID, time.Now()); err != nil {
+			log.Println("Error revoking sessions:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		app.recordAdminAction(r, user.ID, data.SecurityEventRoleChange,
+			fmt.Sprintf("The role was changed from %s to %s and %d sessions were revoked", user.Role, role, revoked))
+	}
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Role updated successfully",
+		"userId":  user.ID,
+		"role":    role,
+		"revoked": revoked,
+	})
+}
+
+// ImpersonateUserHandler returns a short-lived access token that lets an
+// administrator see the API as a user does. The token is read-only unless
+// the request asks for readOnly false, and every request made with it is logged.
+func (app *application) ImpersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Impersonating user...")
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if refuseOwnAccount(w, r, user, "Administrators cannot impersonate themselves") {
+		return
+	}
+	// Impersonating an administrator would only add their permissions
+	if user.Role == data.RoleAdmin {
+		http.Error(w, "Administrators cannot be impersonated", http.StatusForbidden)
+		return
+	}
+	if user.Status() != data.UserStatusActive {
+		http.Error(w, "Only active users can be impersonated", http.StatusConflict)
+		return
+	}
+
+	// The request body is optional
+	var request struct {
+		ReadOnly *bool  `json:"readOnly"`
+		Reason   string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	readOnly := request.ReadOnly == nil || *request.ReadOnly
+	if utf8.RuneCountInString(request.Reason) > maxImpersonationReasonLength {
+		http.Error(w, fmt.Sprintf("The reason must be at most %d characters", maxImpersonationReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	// No token is issued unless the impersonation is on record
+	access := "read-only"
+	if !readOnly {
+		access = "read-write"
+	}
+	details := fmt.Sprintf("A %s impersonation token was issued for %d minutes", access, int(impersonationTokenLifetime.Minutes()))
+	if request.Reason != "" {
+		details += ": " + request.Reason
+	}
+	if err := app.recordAdminAction(r, user.ID, data.SecurityEventImpersonation, details); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := app.generateImpersonationJWT(user, principalFrom(r), readOnly)
+	if err != nil {
+		log.Println("Error generating impersonation token:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accessToken": accessToken,
+		"expiresIn":   int(impersonationTokenLifetime.Seconds()),
+		"readOnly":    readOnly,
+		"user":        newAdminUser(user),
+	})
+}
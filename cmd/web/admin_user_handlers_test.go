@@ -0,0 +1,290 @@
+// admin_user_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	app, _ := newTestApp(t)
+	customerID := registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	_, agentToken := registerStaff(t, app, "agent@example.com", data.RoleAgent)
+	_, supervisorToken := registerStaff(t, app, "supervisor@example.com", data.RoleSupervisor)
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userPath := fmt.Sprintf("/admin/users/%d", customerID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"customers cannot read every ticket", http.MethodGet, "/admin/tickets", customerToken, http.StatusForbidden},
+		{"agents read every ticket", http.MethodGet, "/admin/tickets", agentToken, http.StatusOK},
+		{"agents cannot view reports", http.MethodGet, "/admin/reports/tickets", agentToken, http.StatusForbidden},
+		{"supervisors view reports", http.MethodGet, "/admin/reports/tickets", supervisorToken, http.StatusOK},
+		{"supervisors cannot manage users", http.MethodGet, userPath, supervisorToken, http.StatusForbidden},
+		{"supervisors cannot delete users", http.MethodDelete, userPath, supervisorToken, http.StatusForbidden},
+		{"admins manage users", http.MethodGet, userPath, adminToken, http.StatusOK},
+		{"admins list the roles", http.MethodGet, "/admin/roles", adminToken, http.StatusOK},
+		{"no token", http.MethodGet, "/admin/tickets", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := request(t, app, tt.method, tt.path, nil, tt.token); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestSetUserRoleHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	adminID, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	userToken, userRefreshToken := login(t, app, "user@example.com", "secret")
+	path := fmt.Sprintf("/admin/users/%d/role", userID)
+
+	if w := request(t, app, http.MethodPut, path, map[string]string{"role": "owner"}, adminToken); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := request(t, app, http.MethodPut, fmt.Sprintf("/admin/users/%d/role", adminID), map[string]string{"role": data.RoleAgent}, adminToken); w.Code != http.StatusForbidden {
+		t.Errorf("own role: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w := request(t, app, http.MethodPut, path, map[string]string{"role": data.RoleSupervisor}, adminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set role: status %d: %s", w.Code, w.Body.String())
+	}
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Role != data.RoleSupervisor || user.IsAdmin != 0 {
+		t.Errorf("role = %q, IsAdmin = %d, want a supervisor", user.Role, user.IsAdmin)
+	}
+
+	// No token issued before the change still carries the old role
+	if w := request(t, app, http.MethodGet, "/profile", nil, userToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token from before the change: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, userRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token from before the change: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	userToken, _ = login(t, app, "user@example.com", "secret")
+	if w := request(t, app, http.MethodGet, "/admin/reports/tickets", nil, userToken); w.Code != http.StatusOK {
+		t.Errorf("report with the new role: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Setting the role a user already has leaves their sessions alone
+	w = request(t, app, http.MethodPut, path, map[string]string{"role": data.RoleSupervisor}, adminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("same role: status %d: %s", w.Code, w.Body.String())
+	}
+	if revoked := decode(t, w)["revoked"]; revoked != float64(0) {
+		t.Errorf("same role: %v sessions revoked, want 0", revoked)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, userToken); w.Code != http.StatusOK {
+		t.Errorf("access token after setting the same role: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestListUsersHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	registerStaff(t, app, "agent@example.com", data.RoleAgent)
+	registerUser(t, app, "alice@example.com", "secret")
+	registerUser(t, app, "bob@example.com", "secret")
+
+	tests := []struct {
+		query string
+		count int
+		total int
+	}{
+		{"", 4, 4},
+		{"?q=ALICE", 1, 1},
+		{"?role=agent", 1, 1},
+		{"?role=customer&perPage=1", 1, 2},
+		{"?role=customer&perPage=1&page=2", 1, 2},
+		{"?role=customer&perPage=1&page=3", 0, 2},
+	}
+	for _, tt := range tests {
+		w := request(t, app, http.MethodGet, "/admin/users"+tt.query, nil, adminToken)
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status %d: %s", tt.query, w.Code, w.Body.String())
+			continue
+		}
+		body := decode(t, w)
+		users, _ := body["users"].([]interface{})
+		if len(users) != tt.count || body["total"] != float64(tt.total) {
+			t.Errorf("%q: %d users of %v, want %d of %d", tt.query, len(users), body["total"], tt.count, tt.total)
+		}
+	}
+
+	for _, query := range []string{"?role=owner", "?status=asleep", "?page=0", "?perPage=101"} {
+		if w := request(t, app, http.MethodGet, "/admin/users"+query, nil, adminToken); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestDeactivateUserHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	events := &recordingStore{Store: store}
+	app.store = events
+	adminID, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	userToken, _ := login(t, app, "user@example.com", "secret")
+	path := fmt.Sprintf("/admin/users/%d", userID)
+
+	if w := request(t, app, http.MethodPost, fmt.Sprintf("/admin/users/%d/deactivate", adminID), nil, adminToken); w.Code != http.StatusForbidden {
+		t.Errorf("own account: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Deactivation signs the user out and keeps them from logging in
+	w := request(t, app, http.MethodPost, path+"/deactivate", nil, adminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deactivate: status %d: %s", w.Code, w.Body.String())
+	}
+	if revoked := decode(t, w)["revoked"]; revoked != float64(1) {
+		t.Errorf("%v sessions revoked, want 1", revoked)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, userToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of a deactivated user: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = request(t, app, http.MethodPost, "/login", map[string]string{"email": "user@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("login of a deactivated user: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := request(t, app, http.MethodPost, path+"/deactivate", nil, adminToken); w.Code != http.StatusConflict {
+		t.Errorf("deactivating twice: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	if w := request(t, app, http.MethodPost, path+"/reactivate", nil, adminToken); w.Code != http.StatusOK {
+		t.Fatalf("reactivate: status %d: %s", w.Code, w.Body.String())
+	}
+	login(t, app, "user@example.com", "secret")
+	if w := request(t, app, http.MethodPost, path+"/reactivate", nil, adminToken); w.Code != http.StatusConflict {
+		t.Errorf("reactivating an active user: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// Both actions are recorded with the administrator who took them
+	for _, eventType := range []string{data.SecurityEventAccountDeactivated, data.SecurityEventAccountReactivated} {
+		recorded := events.eventsOfType(eventType)
+		if len(recorded) != 1 || recorded[0].UserID != userID || recorded[0].ActorID == nil || *recorded[0].ActorID != adminID {
+			t.Errorf("%s events: %+v", eventType, recorded)
+		}
+	}
+}
+
+func TestForceLogoutUserHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	phoneToken, _ := login(t, app, "user@example.com", "secret")
+	laptopToken, laptopRefreshToken := login(t, app, "user@example.com", "secret")
+
+	w := request(t, app, http.MethodPost, fmt.Sprintf("/admin/users/%d/logout", userID), nil, adminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("force logout: status %d: %s", w.Code, w.Body.String())
+	}
+	if revoked := decode(t, w)["revoked"]; revoked != float64(2) {
+		t.Errorf("%v sessions revoked, want 2", revoked)
+	}
+	for _, token := range []string{phoneToken, laptopToken} {
+		if w := request(t, app, http.MethodGet, "/profile", nil, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("access token after a forced logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, laptopRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after a forced logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// The user can log in again
+	login(t, app, "user@example.com", "secret")
+}
+
+func TestPromoteAndDemoteUserHandlers(t *testing.T) {
+	app, store := newTestApp(t)
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	path := fmt.Sprintf("/admin/users/%d", userID)
+
+	steps := []struct {
+		action string
+		status int
+		role   string
+	}{
+		{"demote", http.StatusConflict, data.RoleCustomer},
+		{"promote", http.StatusOK, data.RoleAgent},
+		{"promote", http.StatusOK, data.RoleSupervisor},
+		{"promote", http.StatusOK, data.RoleAdmin},
+		{"promote", http.StatusConflict, data.RoleAdmin},
+		{"demote", http.StatusOK, data.RoleSupervisor},
+	}
+	for _, step := range steps {
+		if w := request(t, app, http.MethodPost, path+"/"+step.action, nil, adminToken); w.Code != step.status {
+			t.Errorf("%s: status %d, want %d: %s", step.action, w.Code, step.status, w.Body.String())
+		}
+		user, err := store.GetUserByID(userID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		if user.Role != step.role {
+			t.Errorf("%s: role = %q, want %q", step.action, user.Role, step.role)
+		}
+	}
+}
+
+func TestResendVerificationHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	verifiedID := registerUser(t, app, "verified@example.com", "secret")
+
+	w := request(t, app, http.MethodPost, "/register", map[string]string{"email": "pending@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("register: status %d", w.Code)
+	}
+	pendingID := int(decode(t, w)["userID"].(float64))
+
+	if w := request(t, app, http.MethodPost, fmt.Sprintf("/admin/users/%d/resend-verification", verifiedID), nil, adminToken); w.Code != http.StatusConflict {
+		t.Errorf("verified user: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// The PIN sent at registration is still cooling down
+	path := fmt.Sprintf("/admin/users/%d/resend-verification", pendingID)
+	if w := request(t, app, http.MethodPost, path, nil, adminToken); w.Code != http.StatusTooManyRequests {
+		t.Errorf("resend right after registering: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+	adminID, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	userToken, _ := login(t, app, "user@example.com", "secret")
+	path := fmt.Sprintf("/admin/users/%d", userID)
+
+	if w := request(t, app, http.MethodDelete, fmt.Sprintf("/admin/users/%d", adminID), nil, adminToken); w.Code != http.StatusForbidden {
+		t.Errorf("own account: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := request(t, app, http.MethodDelete, path, nil, adminToken); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(t, app, http.MethodGet, path, nil, adminToken); w.Code != http.StatusNotFound {
+		t.Errorf("deleted user: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, userToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of a deleted user: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(t, app, http.MethodDelete, path, nil, adminToken); w.Code != http.StatusNotFound {
+		t.Errorf("deleting twice: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(t, app, http.MethodGet, "/admin/users/abc", nil, adminToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid user ID: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
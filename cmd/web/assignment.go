@@ -0,0 +1,110 @@
+// assignment.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// assignmentStrategy reads the automatic ticket assignment strategy from
+// TICKET_ASSIGNMENT. An empty value or "none" turns automatic assignment off.
+func assignmentStrategy() (string, error) {
+	strategy := os.Getenv("TICKET_ASSIGNMENT")
+	if strategy == "" || strategy == "none" {
+		return "", nil
+	}
+	if !data.ValidAssignmentStrategy(strategy) {
+		return "", fmt.Errorf("unknown TICKET_ASSIGNMENT %q (expected %s, %s or none)", strategy, data.AssignRoundRobin, data.AssignLeastOpen)
+	}
+	return strategy, nil
+}
+
+// autoAssignTicket assigns a new ticket to an available operator using the
+// configured strategy. Failures are logged; the ticket then stays unassigned.
+func (app *application) autoAssignTicket(ticketID int64) {
+	if app.assignment == "" {
+		return
+	}
+
+	now := time.Now()
+	operators, err := app.store.GetAssignableOperators(now)
+	if err != nil {
+		log.Printf("Failed to list operators for ticket %d: %v", ticketID, err)
+		return
+	}
+
+	operatorID, ok := data.ChooseOperator(app.assignment, operators)
+	if !ok {
+		log.Printf("No operator available for ticket %d, leaving it unassigned", ticketID)
+		return
+	}
+
+	if err := app.store.AssignTicket(ticketID, 0, int64(operatorID)); err != nil {
+		log.Printf("Failed to assign ticket %d to operator %d: %v", ticketID, operatorID, err)
+		return
+	}
+	if err := app.store.RecordTicketAssignment(operatorID, now); err != nil {
+		log.Printf("Failed to record assignment for operator %d: %v", operatorID, err)
+	}
+
+	log.Printf("Ticket %d assigned to operator %d (%s)", ticketID, operatorID, app.assignment)
+}
+
+// GetAvailabilityHandler returns the availability of the admin making the request
+func (app *application) GetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Getting operator availability...")
+
+	availability, err := app.store.GetOperatorAvailability(principalFrom(r).UserID)
+	if err != nil {
+		log.Println("Failed to retrieve availability:", err)
+		http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with the availability
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
+
+// UpdateAvailabilityHandler lets an admin mark themselves available, unavailable or out of office
+func (app *application) UpdateAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Updating operator availability...")
+
+	// Parse the request body
+	var request struct {
+		Available        bool       `json:"available"`
+		OutOfOfficeUntil *time.Time `json:"outOfOfficeUntil"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	availability := data.OperatorAvailability{
+		UserID:           principalFrom(r).UserID,
+		Available:        request.Available,
+		OutOfOfficeUntil: request.OutOfOfficeUntil,
+	}
+	if err := app.store.SetOperatorAvailability(availability); err != nil {
+		if errors.Is(err, data.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to update availability:", err)
+		http.Error(w, "Failed to update availability", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with the new availability
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
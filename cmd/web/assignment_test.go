@@ -0,0 +1,164 @@
+// assignment_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetOperatorAvailability(t *testing.T) {
+	for name, store := range testStores(t) {
+		operatorID := createTestUser(t, store, "agent@example.com", data.RoleAgent)
+
+		// Saving the availability an operator already has is not a missing user
+		availability := data.OperatorAvailability{UserID: operatorID, Available: false}
+		for i := 0; i < 2; i++ {
+			if err := store.SetOperatorAvailability(availability); err != nil {
+				t.Errorf("%s: update %d: %v", name, i+1, err)
+			}
+		}
+		got, err := store.GetOperatorAvailability(operatorID)
+		if err != nil {
+			t.Fatalf("%s: GetOperatorAvailability: %v", name, err)
+		}
+		if got.Available {
+			t.Errorf("%s: the operator is still available", name)
+		}
+
+		availability.UserID = operatorID + 100
+		if err := store.SetOperatorAvailability(availability); !errors.Is(err, data.ErrUserNotFound) {
+			t.Errorf("%s: unknown user: error = %v, want %v", name, err, data.ErrUserNotFound)
+		}
+	}
+}
+
+func TestGetAssignableOperators(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	for name, store := range testStores(t) {
+		customerID := createTestUser(t, store, "customer@example.com", data.RoleCustomer)
+		availableID := createTestUser(t, store, "available@example.com", data.RoleAgent)
+		unavailableID := createTestUser(t, store, "unavailable@example.com", data.RoleAgent)
+		awayID := createTestUser(t, store, "away@example.com", data.RoleSupervisor)
+
+		if err := store.SetOperatorAvailability(data.OperatorAvailability{UserID: unavailableID}); err != nil {
+			t.Fatalf("%s: SetOperatorAvailability: %v", name, err)
+		}
+		if err := store.SetOperatorAvailability(data.OperatorAvailability{UserID: awayID, Available: true, OutOfOfficeUntil: &later}); err != nil {
+			t.Fatalf("%s: SetOperatorAvailability: %v", name, err)
+		}
+
+		ticketID, err := store.CreateTicket(customerID, "Subject", "Issue", data.TicketPriorityNormal)
+		if err != nil {
+			t.Fatalf("%s: CreateTicket: %v", name, err)
+		}
+		if err := store.AssignTicket(int64(ticketID), 0, int64(availableID)); err != nil {
+			t.Fatalf("%s: AssignTicket: %v", name, err)
+		}
+
+		operators, err := store.GetAssignableOperators(now)
+		if err != nil {
+			t.Fatalf("%s: GetAssignableOperators: %v", name, err)
+		}
+		if len(operators) != 1 || operators[0].UserID != availableID || operators[0].OpenTickets != 1 {
+			t.Errorf("%s: operators = %+v, want only %d with 1 open ticket", name, operators, availableID)
+		}
+
+		// Operators are back once their out-of-office time has passed
+		operators, err = store.GetAssignableOperators(later.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("%s: GetAssignableOperators: %v", name, err)
+		}
+		if len(operators) != 2 {
+			t.Errorf("%s: after the out-of-office time: operators = %+v, want 2", name, operators)
+		}
+	}
+}
+
+func TestChooseOperator(t *testing.T) {
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+	operators := []data.OperatorLoad{
+		{UserID: 1, OpenTickets: 3, LastAssignedAt: &earlier},
+		{UserID: 2, OpenTickets: 1, LastAssignedAt: &later},
+		{UserID: 3, OpenTickets: 1, LastAssignedAt: nil},
+	}
+
+	tests := []struct {
+		strategy  string
+		operators []data.OperatorLoad
+		want      int
+	}{
+		{data.AssignRoundRobin, operators, 3},
+		{data.AssignRoundRobin, operators[:2], 1},
+		{data.AssignLeastOpen, operators, 3},
+		{data.AssignLeastOpen, operators[:2], 2},
+	}
+	for _, tt := range tests {
+		got, ok := data.ChooseOperator(tt.strategy, tt.operators)
+		if !ok || got != tt.want {
+			t.Errorf("%s among %d operators: chose %d, want %d", tt.strategy, len(tt.operators), got, tt.want)
+		}
+	}
+
+	if _, ok := data.ChooseOperator(data.AssignRoundRobin, nil); ok {
+		t.Error("an operator was chosen from none")
+	}
+}
+
+func TestAutoAssignTicket(t *testing.T) {
+	app, store := newTestApp(t)
+	app.assignment = data.AssignRoundRobin
+	firstID, _ := registerStaff(t, app, "first@example.com", data.RoleAgent)
+	secondID, secondToken := registerStaff(t, app, "second@example.com", data.RoleAgent)
+	registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+
+	// Round-robin hands consecutive tickets to different operators
+	assignees := map[int64]bool{}
+	for i := 0; i < 2; i++ {
+		ticket, err := store.GetTicketByID(createTicket(t, app, customerToken))
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if ticket.AssignedTo == nil {
+			t.Fatalf("ticket %d was not assigned", ticket.ID)
+		}
+		assignees[*ticket.AssignedTo] = true
+	}
+	if !assignees[int64(firstID)] || !assignees[int64(secondID)] {
+		t.Errorf("tickets were assigned to %v, want both operators", assignees)
+	}
+
+	// Unavailable operators are skipped
+	w := request(t, app, http.MethodPut, "/admin/availability", map[string]bool{"available": false}, secondToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update availability: status %d: %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		ticket, err := store.GetTicketByID(createTicket(t, app, customerToken))
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if ticket.AssignedTo == nil || *ticket.AssignedTo != int64(firstID) {
+			t.Errorf("ticket %d was assigned to %v, want %d", ticket.ID, ticket.AssignedTo, firstID)
+		}
+	}
+
+	// Without any available operator tickets stay unassigned
+	if err := store.SetOperatorAvailability(data.OperatorAvailability{UserID: firstID}); err != nil {
+		t.Fatalf("SetOperatorAvailability: %v", err)
+	}
+	ticket, err := store.GetTicketByID(createTicket(t, app, customerToken))
+	if err != nil {
+		t.Fatalf("GetTicketByID: %v", err)
+	}
+	if ticket.AssignedTo != nil {
+		t.Errorf("ticket %d was assigned to %d with no operator available", ticket.ID, *ticket.AssignedTo)
+	}
+}
@@ -0,0 +1,130 @@
+// auth.go
+
+package main
+
+import (
+	"backend-project/data"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// contextKey is the type of the request context keys set by the middleware
+type contextKey string
+
+// principalKey holds the principal authenticated by validateAccessToken
+const principalKey contextKey = "principal"
+
+// principal is the authenticated user making a request, as read from the access token
+type principal struct {
+	UserID    int
+	Email     string
+	Role      string
+	SessionID int64
+	TwoFactor bool // Whether the login was confirmed with a second factor
+	ActorID   int  // Administrator impersonating the user, or zero
+	ReadOnly  bool // Whether the impersonation token only allows reading
+}
+
+// isStaff reports whether the principal is an agent, supervisor or administrator
+func (p principal) isStaff() bool {
+	return data.StaffRole(p.Role)
+}
+
+// can reports whether the role of the principal grants a permission
+func (p principal) can(permission string) bool {
+	return rolePermits(p.Role, permission)
+}
+
+// principalFrom returns the principal authenticated by validateAccessToken.
+// It returns the zero principal on routes without the middleware.
+func principalFrom(r *http.Request) principal {
+	p, _ := r.Context().Value(principalKey).(principal)
+	return p
+}
+
+// unauthorized rejects a request that is not authenticated. Every
+// authentication failure is reported with status 401 and a Bearer challenge.
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// bearerToken returns the token from the Authorization header, without its "Bearer " prefix
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// validateAccessToken verifies the signature and expiry of the access token
+// and stores the authenticated principal in the request context
+func (app *application) validateAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Extract the access token from the Authorization header
+		accessToken := bearerToken(r)
+		if accessToken == "" {
+			unauthorized(w, "Access token is required")
+			return
+		}
+
+		// Verify the token and read the user from its claims
+		claims, err := app.parseAccessToken(accessToken)
+		if err != nil {
+			var validationErr *jwt.ValidationError
+			if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+				unauthorized(w, "Access token has expired")
+				return
+			}
+			unauthorized(w, "Invalid access token")
+			return
+		}
+		userID, err := claims.userID()
+		if err != nil {
+			unauthorized(w, "Invalid access token")
+			return
+		}
+		actorID, err := claims.actorID()
+		if err != nil {
+			unauthorized(w, "Invalid access token")
+			return
+		}
+
+		// Reject tokens whose session was revoked by logging out. Impersonation
+		// tokens carry the session of the administrator.
+		if app.revocations != nil {
+			sessionUserID := userID
+			if actorID != 0 {
+				sessionUserID = actorID
+			}
+			revoked, err := app.revocations.isRevoked(claims.SessionID, sessionUserID)
+			if err != nil {
+				log.Println("Failed to check access token revocation:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				unauthorized(w, "Access token has been revoked")
+				return
+			}
+		}
+
+		// Call the next handler with the authenticated principal
+		ctx := context.WithValue(r.Context(), principalKey, principal{
+			UserID:    userID,
+			Email:     claims.Email,
+			Role:      claims.Role,
+			SessionID: claims.SessionID,
+			TwoFactor: claims.twoFactor(),
+			ActorID:   actorID,
+			ReadOnly:  claims.ReadOnly,
+		})
+		r = r.WithContext(ctx)
+		if actorID != 0 && !app.allowImpersonated(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+// impersonation.go
+
+package main
+
+import (
+	"backend-project/data"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// impersonationForbiddenRoutes holds the routes impersonation tokens are
+// refused on even when they allow changes, keyed by method and path template.
+// They manage the credentials and sessions of the user, and the sessions
+// would be those of the administrator.
+var impersonationForbiddenRoutes = map[string]bool{
+	"POST /logout":                           true,
+	"GET /sessions":                          true,
+	"POST /sessions/revoke-others":           true,
+	"DELETE /sessions/{sessionID}":           true,
+	"PATCH /profile":                         true,
+	"POST /profile/password":                 true,
+	"POST /profile/email/verify":             true,
+	"POST /2fa/enrol":                        true,
+	"POST /2fa/enable":                       true,
+	"POST /2fa/disable":                      true,
+	"POST /2fa/recovery-codes":               true,
+	"POST /admin/users/{userID}/impersonate": true,
+}
+
+// allowImpersonated checks a request made with an impersonation token and
+// logs it. It writes the error response and returns false when the token
+// does not allow the request.
+func (app *application) allowImpersonated(w http.ResponseWriter, r *http.Request) bool {
+	p := principalFrom(r)
+	log.Printf("Administrator %d as user %d: %s %s", p.ActorID, p.UserID, r.Method, r.URL.Path)
+
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil && impersonationForbiddenRoutes[r.Method+" "+template] {
+			http.Error(w, "Access denied. Not allowed while impersonating a user.", http.StatusForbidden)
+			return false
+		}
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	if p.ReadOnly {
+		http.Error(w, "Access denied. The impersonation token is read-only.", http.StatusForbidden)
+		return false
+	}
+
+	// Changes made as the user are part of their security history
+	actorID := p.ActorID
+	app.saveSecurityEvent(r, &data.SecurityEvent{
+		UserID:  p.UserID,
+		Type:    data.SecurityEventImpersonatedChange,
+		Details: r.Method + " " + r.URL.Path,
+		ActorID: &actorID,
+	})
+	return true
+}
@@ -0,0 +1,128 @@
+// impersonation_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// impersonate gets an impersonation token for a user and returns the response
+func impersonate(t *testing.T, app *application, userID int, body interface{}, token string) (string, int) {
+	t.Helper()
+	w := request(t, app, http.MethodPost, fmt.Sprintf("/admin/users/%d/impersonate", userID), body, token)
+	if w.Code != http.StatusOK {
+		return "", w.Code
+	}
+	return decode(t, w)["accessToken"].(string), w.Code
+}
+
+func TestImpersonateUserHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	events := &recordingStore{Store: store}
+	app.store = events
+	adminID, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	otherAdminID, _ := registerStaff(t, app, "other@example.com", data.RoleAdmin)
+	customerID := registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	ticketID := createTicket(t, app, customerToken)
+
+	if _, status := impersonate(t, app, adminID, nil, adminToken); status != http.StatusForbidden {
+		t.Errorf("impersonating oneself: status %d, want %d", status, http.StatusForbidden)
+	}
+	if _, status := impersonate(t, app, otherAdminID, nil, adminToken); status != http.StatusForbidden {
+		t.Errorf("impersonating an administrator: status %d, want %d", status, http.StatusForbidden)
+	}
+	if _, status := impersonate(t, app, adminID, nil, customerToken); status != http.StatusForbidden {
+		t.Errorf("impersonating without the permission: status %d, want %d", status, http.StatusForbidden)
+	}
+
+	// Tokens are read-only by default and see what the user sees
+	token, status := impersonate(t, app, customerID, map[string]string{"reason": "Ticket missing"}, adminToken)
+	if status != http.StatusOK {
+		t.Fatalf("impersonate: status %d", status)
+	}
+	if w := request(t, app, http.MethodGet, fmt.Sprintf("/tickets/%d", ticketID), nil, token); w.Code != http.StatusOK {
+		t.Errorf("reading the user's ticket: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := request(t, app, http.MethodPost, "/tickets", map[string]string{"subject": "S", "issue": "I"}, token); w.Code != http.StatusForbidden {
+		t.Errorf("change with a read-only token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := request(t, app, http.MethodGet, "/admin/tickets", nil, token); w.Code != http.StatusForbidden {
+		t.Errorf("admin endpoint as the user: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	recorded := events.eventsOfType(data.SecurityEventImpersonation)
+	if len(recorded) != 1 || recorded[0].UserID != customerID || recorded[0].ActorID == nil || *recorded[0].ActorID != adminID ||
+		!strings.HasSuffix(recorded[0].Details, ": Ticket missing") {
+		t.Errorf("impersonation events: %+v", recorded)
+	}
+
+	// Read-write tokens record each change, and still cannot manage the user's credentials
+	token, status = impersonate(t, app, customerID, map[string]bool{"readOnly": false}, adminToken)
+	if status != http.StatusOK {
+		t.Fatalf("impersonate read-write: status %d", status)
+	}
+	if w := request(t, app, http.MethodPost, "/tickets", map[string]string{"subject": "S", "issue": "I"}, token); w.Code != http.StatusOK {
+		t.Errorf("change with a read-write token: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if changes := events.eventsOfType(data.SecurityEventImpersonatedChange); len(changes) != 1 || changes[0].ActorID == nil || *changes[0].ActorID != adminID {
+		t.Errorf("impersonated change events: %+v", changes)
+	}
+	if w := request(t, app, http.MethodPost, "/profile/password", map[string]string{"currentPassword": "secret", "newPassword": "other"}, token); w.Code != http.StatusForbidden {
+		t.Errorf("password change with a read-write token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// The token belongs to the administrator's session
+	if w := request(t, app, http.MethodPost, "/logout", nil, adminToken); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	if w := request(t, app, http.MethodGet, "/tickets", nil, token); w.Code != http.StatusUnauthorized {
+		t.Errorf("token after the administrator logged out: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestImpersonationReasonLength(t *testing.T) {
+	app, store := newTestApp(t)
+	events := &recordingStore{Store: store}
+	app.store = events
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	customerID := registerUser(t, app, "customer@example.com", "secret")
+
+	// The limit counts characters, not bytes
+	reason := strings.Repeat("é", maxImpersonationReasonLength)
+	if _, status := impersonate(t, app, customerID, map[string]string{"reason": reason}, adminToken); status != http.StatusOK {
+		t.Errorf("reason of %d characters: status %d, want %d", maxImpersonationReasonLength, status, http.StatusOK)
+	}
+	if _, status := impersonate(t, app, customerID, map[string]string{"reason": reason + "é"}, adminToken); status != http.StatusBadRequest {
+		t.Errorf("reason of %d characters: status %d, want %d", maxImpersonationReasonLength+1, status, http.StatusBadRequest)
+	}
+
+	recorded := events.eventsOfType(data.SecurityEventImpersonation)
+	if len(recorded) != 1 {
+		t.Fatalf("%d impersonation events, want 1", len(recorded))
+	}
+	if length := len([]rune(recorded[0].Details)); length > 255 {
+		t.Errorf("the details are %d characters long, more than their column holds", length)
+	}
+}
+
+func TestImpersonationWithoutAuditRecord(t *testing.T) {
+	app, store := newTestApp(t)
+	events := &recordingStore{Store: store}
+	app.store = events
+	_, adminToken := registerStaff(t, app, "admin@example.com", data.RoleAdmin)
+	customerID := registerUser(t, app, "customer@example.com", "secret")
+
+	events.failEvents = true
+	w := request(t, app, http.MethodPost, fmt.Sprintf("/admin/users/%d/impersonate", customerID), nil, adminToken)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(w.Body.String(), "accessToken") {
+		t.Error("a token was issued without a security event")
+	}
+}
@@ -0,0 +1,232 @@
+// login_throttle.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// loginFailureWindow is how long failed logins are remembered after the last one
+const loginFailureWindow = time.Hour
+
+// maxLoginDelay caps the wait between failed logins before a lockout
+const maxLoginDelay = time.Minute
+
+// loginThrottleLimit is the number of tracked addresses above which stale entries are dropped
+const loginThrottleLimit = 10000
+
+// loginPolicy decides how failed logins slow down further attempts. The
+// first failures are free, each further failure doubles the wait before the
+// next attempt, and reaching the lockout threshold refuses logins for a while.
+type loginPolicy struct {
+	freeFailures    int
+	lockoutFailures int
+	lockout         time.Duration
+}
+
+var (
+	// accountLoginPolicy applies to the failed logins with one email address
+	accountLoginPolicy = loginPolicy{freeFailures: 3, lockoutFailures: 10, lockout: 15 * time.Minute}
+	// ipLoginPolicy applies to the failed logins from one client IP address,
+	// which may be shared by many users
+	ipLoginPolicy = loginPolicy{freeFailures: 20, lockoutFailures: 100, lockout: 15 * time.Minute}
+)
+
+// delay returns how long to wait after the given number of failed logins
+func (p loginPolicy) delay(failures int) time.Duration {
+	if failures <= p.freeFailures {
+		return 0
+	}
+	delay := time.Second << (failures - p.freeFailures - 1)
+	if delay > maxLoginDelay || delay <= 0 {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// retryAfter returns how long logins are refused after the recorded failed
+// logins, or zero when a login may be attempted now
+func (p loginPolicy) retryAfter(failures *data.LoginFailures, now time.Time) time.Duration {
+	if failures.LockedUntil != nil {
+		return failures.LockedUntil.Sub(now)
+	}
+	if failures.LastFailedAt == nil {
+		return 0
+	}
+	return failures.LastFailedAt.Add(p.delay(failures.FailedAttempts)).Sub(now)
+}
+
+// loginFailuresStale reports whether recorded failed logins should be
+// forgotten, because their lock has expired or the last of them is old enough
+func loginFailuresStale(failures *data.LoginFailures, now time.Time) bool {
+	if failures.LockedUntil != nil {
+		return !now.Before(*failures.LockedUntil)
+	}
+	return failures.LastFailedAt != nil && now.Sub(*failures.LastFailedAt) >= loginFailureWindow
+}
+
+// loginTooManyAttemptsError is returned when logins are refused for a while
+type loginTooManyAttemptsError struct {
+	retryAfter time.Duration
+}
+
+func (e *loginTooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry in %s", e.retryAfter)
+}
+
+// writeLoginThrottled answers a refused login with 429 and a Retry-After header
+func writeLoginThrottled(w http.ResponseWriter, err *loginTooManyAttemptsError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.retryAfter.Seconds()))))
+	http.Error(w, "Too many failed login attempts. Please try again later.", http.StatusTooManyRequests)
+}
+
+// ipLoginThrottle tracks failed logins per client IP address in memory. The
+// counts are per instance and are not reset by a successful login, so that a
+// valid account of the attacker does not hide guesses at other accounts.
+type ipLoginThrottle struct {
+	mu      sync.Mutex
+	entries map[string]*data.LoginFailures // keyed by client IP address
+}
+
+// newIPLoginThrottle returns an empty per-IP login throttle
+func newIPLoginThrottle() *ipLoginThrottle {
+	return &ipLoginThrottle{entries: make(map[string]*data.LoginFailures)}
+}
+
+// check returns an error when logins from an address are refused for now
+func (t *ipLoginThrottle) check(ip string, now time.Time) *loginTooManyAttemptsError {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures, ok := t.entries[ip]
+	if !ok {
+		return nil
+	}
+	if loginFailuresStale(failures, now) {
+		delete(t.entries, ip)
+		return nil
+	}
+	if wait := ipLoginPolicy.retryAfter(failures, now); wait > 0 {
+		return &loginTooManyAttemptsError{retryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login from an address
+func (t *ipLoginThrottle) recordFailure(ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) >= loginThrottleLimit {
+		for k, f := range t.entries {
+			if loginFailuresStale(f, now) {
+				delete(t.entries, k)
+			}
+		}
+	}
+
+	failures, ok := t.entries[ip]
+	if !ok || loginFailuresStale(failures, now) {
+		failures = &data.LoginFailures{}
+		t.entries[ip] = failures
+	}
+	failedAt := now
+	failures.FailedAttempts++
+	failures.LastFailedAt = &failedAt
+	if failures.FailedAttempts >= ipLoginPolicy.lockoutFailures {
+		lockedUntil := now.Add(ipLoginPolicy.lockout)
+		failures.LockedUntil = &lockedUntil
+		log.Printf("Locking logins from %s after %d failed attempts", ip, failures.FailedAttempts)
+	}
+}
+
+// checkLoginAllowed returns an error when logins with an email address or
+// from the client address of the request are refused for now. Unknown email
+// addresses are throttled exactly like registered ones.
+func (app *application) checkLoginAllowed(r *http.Request, email string) (*loginTooManyAttemptsError, error) {
+	now := time.Now()
+	if err := app.loginThrottle.check(clientIP(r), now); err != nil {
+		return err, nil
+	}
+
+	failures, err := app.store.GetLoginFailures(email)
+	if err != nil {
+		return nil, err
+	}
+	if loginFailuresStale(failures, now) {
+		return nil, nil
+	}
+	if wait := accountLoginPolicy.retryAfter(failures, now); wait > 0 {
+		return &loginTooManyAttemptsError{retryAfter: wait}, nil
+	}
+	return nil, nil
+}
+
+// recordLoginFailure counts a failed login with an email address and from
+// the client address of the request. Reaching the lockout threshold locks
+// the account and lets its owner know.
+func (app *application) recordLoginFailure(r *http.Request, email string) error {
+	now := time.Now()
+	app.loginThrottle.recordFailure(clientIP(r), now)
+
+	// Start counting afresh once earlier failures are forgotten
+	failures, err := app.store.GetLoginFailures(email)
+	if err != nil {
+		return err
+	}
+	if loginFailuresStale(failures, now) {
+		if err := app.store.ClearLoginFailures(email); err != nil {
+			return err
+		}
+	}
+
+	attempts, err := app.store.RecordLoginFailure(email, now)
+	if err != nil {
+		return err
+	}
+	if attempts < accountLoginPolicy.lockoutFailures {
+		return nil
+	}
+	if err := app.store.LockLogin(email, now.Add(accountLoginPolicy.lockout)); err != nil {
+		return err
+	}
+
+	// Only registered users are told, once per lockout
+	if attempts != accountLoginPolicy.lockoutFailures {
+		return nil
+	}
+	user, err := app.store.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	app.recordSecurityEvent(r, user.ID, data.SecurityEventAccountLocked,
+		fmt.Sprintf("Logins were locked for %d minutes after %d failed attempts", int(accountLoginPolicy.lockout.Minutes()), attempts))
+
+	// Send the email in the background, so that the response time does not
+	// reveal whether the email address is registered
+	go func(email string) {
+		if err := sendEmail(email, "Your account has been locked", accountLockedEmail()); err != nil {
+			log.Println("Error sending account locked email:", err)
+		}
+	}(user.Email)
+
+	return nil
+}
+
+// accountLockedEmail returns the body of the email sent when an account is locked
+func accountLockedEmail() string {
+	return fmt.Sprintf("There were too many failed attempts to log in to your account, so logins are refused for the next %d minutes. "+
+		"If this was not you, consider resetting your password. Contact support to unlock your account sooner.",
+		int(accountLoginPolicy.lockout.Minutes()))
+}
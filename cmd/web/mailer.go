@@ -3,6 +3,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/smtp"
 	"os"
@@ -11,12 +12,24 @@ import (
 
 // sendPinByEmail sends a PIN code to the specified email address
 func sendPinByEmail(email, pin string) error {
+	body := fmt.Sprintf("Your PIN code is: %s. It expires in %d minutes.", pin, int(pinLifetime.Minutes()))
+	return sendEmail(email, "Your PIN Code", body)
+}
+
+// sendEmail sends an email with the given subject and body to the specified email address
+func sendEmail(email, subject, body string) error {
 	// SMTP server configuration
 	smtpHost := os.Getenv("SMTP_HOST")     // SMTP server host
 	smtpPortStr := os.Getenv("SMTP_PORT")  // SMTP server port as string
 	username := os.Getenv("SMTP_USERNAME") // SMTP username for authentication
 	password := os.Getenv("SMTP_PASSWORD") // SMTP password for authentication
 
+	// Without an SMTP server (e.g. in demo mode) log the email instead of sending it
+	if smtpHost == "" {
+		log.Printf("SMTP_HOST is not set, not sending email to %s: %s", email, body)
+		return nil
+	}
+
 	// Convert smtpPort string to integer
 	smtpPort, err := strconv.Atoi(smtpPortStr) // Convert port string to integer
 	if err != nil {
@@ -30,10 +43,6 @@ func sendPinByEmail(email, pin string) error {
 	from := username      // Using the same username as sender
 	to := []string{email} // Recipient email address
 
-	// Email content
-	subject := "Your PIN Code"         // Email subject
-	body := "Your PIN code is: " + pin // Email body containing the PIN code
-
 	// Constructing the email message
 	message := []byte("From: ticketplatform@email.com\r\n" +
 		"To: " + to[0] + "\r\n" +
@@ -46,7 +55,7 @@ func sendPinByEmail(email, pin string) error {
 		return err // Return error if sending email fails
 	}
 
-	// Log message if the PIN code is sent successfully
-	log.Println("PIN code sent successfully to", email)
+	// Log message if the email is sent successfully
+	log.Printf("Email %q sent successfully to %s", subject, email)
 	return nil // Return nil (no error) if everything succeeds
 }
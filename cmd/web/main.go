@@ -3,24 +3,42 @@ package main
 
 import (
 	"backend-project/data"
-	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
 
 func init() {
-	// Load environment variables from .env file
+	// Load environment variables from .env file, falling back to the process environment
 	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+		log.Println("No .env file loaded, using the process environment")
 	}
 }
 
+// application holds the dependencies shared by the HTTP handlers
+type application struct {
+	store       data.Store
+	assignment  string           // automatic ticket assignment strategy; empty when turned off
+	revocations *revocationCache // cached session revocation check; nil when turned off
+	accessKeys  *keyRing         // keys access tokens are signed and verified with
+	refreshKeys *keyRing         // keys refresh tokens are signed and verified with
+
+	loginThrottle *ipLoginThrottle // failed logins per client IP address
+	rateLimits    rateLimitStore   // token buckets of the rate limiter; nil when turned off
+
+	tokenIssuer   string // iss claim of issued tokens, required on presented tokens when set
+	tokenAudience string // aud claim of issued tokens, required on presented tokens when set
+
+	echoPins bool // return emailed PINs in API responses; development only
+
+	twoFactorIssuer        string // issuer name shown by authenticator apps
+	staffTwoFactorRequired bool   // refuse admin endpoints to staff sessions without a second factor
+}
+
 // HelloWorldHandler returns a simple "Hello, World!" message, helps ensures server loads
 func HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
@@ -29,94 +47,223 @@ func HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	// Hardcoded database connection details for testing
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_DATABASE")
+	// The migrate subcommand manages the database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Construct data source name
-	dataSourceName := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPassword, dbHost, dbPort, dbName)
+	// Open the storage backend selected by DB_DRIVER (MySQL by default)
+	driver := os.Getenv("DB_DRIVER")
+	store, err := openStore(driver)
+	if err != nil {
+		log.Fatal("Error opening the data store:", err)
+	}
 
-	// Print dataSourceName for debugging
-	log.Println("DataSourceName:", dataSourceName)
+	// Refuse to start against an outdated schema
+	if err := checkSchema(store, driver); err != nil {
+		log.Fatal(err)
+	}
 
-	// Initialize database connection
-	db, err := sql.Open("mysql", dataSourceName)
+	// Automatic ticket assignment is configured with TICKET_ASSIGNMENT
+	assignment, err := assignmentStrategy()
 	if err != nil {
-		log.Fatal("Error connecting to the database:", err)
+		log.Fatal(err)
 	}
 
-	// Check if the database connection is successful
-	err = db.Ping()
+	// Revoked access tokens are detected with a cached database lookup
+	revocations, err := newRevocationCache(store)
 	if err != nil {
-		log.Fatal("Error pinging the database:", err)
-	} else {
-		log.Println("Connected to the database.")
+		log.Fatal("Invalid access token revocation settings:", err)
+	}
+
+	// Tokens are signed with the keys configured in the environment
+	accessKeys, refreshKeys, err := loadSigningKeys()
+	if err != nil {
+		log.Fatal("Invalid token signing keys: ", err)
+	}
+
+	// Emailed PINs are only returned in responses when PIN_IN_RESPONSE is set
+	echoPins, err := pinEchoEnabled()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Two-factor authentication is configured with TWO_FACTOR_*
+	twoFactorIssuer, staffTwoFactorRequired, err := twoFactorSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Requests are rate limited unless RATE_LIMIT_ENABLED is false
+	rateLimits, err := newRateLimitStore()
+	if err != nil {
+		log.Fatal("Invalid rate limiting settings:", err)
+	}
+
+	// Wire the store into the handlers
+	app := &application{
+		store:       store,
+		assignment:  assignment,
+		revocations: revocations,
+		accessKeys:  accessKeys,
+		refreshKeys: refreshKeys,
+
+		loginThrottle: newIPLoginThrottle(),
+		rateLimits:    rateLimits,
+
+		tokenIssuer:   os.Getenv("JWT_ISSUER"),
+		tokenAudience: os.Getenv("JWT_AUDIENCE"),
+
+		echoPins: echoPins,
+
+		twoFactorIssuer:        twoFactorIssuer,
+		staffTwoFactorRequired: staffTwoFactorRequired,
 	}
 
-	// Set the database connection in the data package
-	data.SetDB(db)
+	// Start the server
+	port := 8080
+	log.Printf("Server started on :%d...\n", port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), app.routes()))
+}
 
+// routes registers every API endpoint on a new router
+func (app *application) routes() *mux.Router {
 	// Router initialization
 	router := mux.NewRouter()
 
+	// Limit the request rate of every client, per route policy
+	if app.rateLimits != nil {
+		router.Use(app.rateLimitRequests)
+	}
+
 	// Registering API endpoints
 
 	// Registration endpoint (no authentication required)
-	router.HandleFunc("/register", RegisterHandler).Methods("POST")
+	router.HandleFunc("/register", app.RegisterHandler).Methods("POST")
 
 	// VerifyPin endpoint
-	router.HandleFunc("/verify-pin", VerifyPinHandler).Methods("POST")
+	router.HandleFunc("/verify-pin", app.VerifyPinHandler).Methods("POST")
+	router.HandleFunc("/verify-pin/resend", app.ResendPinHandler).Methods("POST")
 
 	// Login endpoint (no authentication required)
-	router.HandleFunc("/login", LoginHandler).Methods("POST")
+	router.HandleFunc("/login", app.LoginHandler).Methods("POST")
+	router.HandleFunc("/login/2fa", app.TwoFactorLoginHandler).Methods("POST")
+
+	// Password reset endpoints (no authentication required)
+	router.HandleFunc("/password/forgot", app.ForgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/password/reset", app.ResetPasswordHandler).Methods("POST")
 
 	// Logout endpoint (requires authentication)
-	router.Handle("/logout", validateAccessToken(http.HandlerFunc(LogoutHandler))).Methods("POST")
+	router.Handle("/logout", app.validateAccessToken(http.HandlerFunc(app.LogoutHandler))).Methods("POST")
+
+	// Session endpoints (require authentication)
+	router.Handle("/sessions", app.validateAccessToken(http.HandlerFunc(app.ListSessionsHandler))).Methods("GET")
+	router.Handle("/sessions/revoke-others", app.validateAccessToken(http.HandlerFunc(app.RevokeOtherSessionsHandler))).Methods("POST")
+	router.Handle("/sessions/{sessionID}", app.validateAccessToken(http.HandlerFunc(app.RevokeSessionHandler))).Methods("DELETE")
 
-	// Profile endpoint (requires authentication)
-	router.Handle("/profile", validateAccessToken(http.HandlerFunc(ProfileHandler))).Methods("GET")
+	// Profile endpoints (require authentication)
+	router.Handle("/profile", app.validateAccessToken(http.HandlerFunc(app.ProfileHandler))).Methods("GET")
+	router.Handle("/profile", app.validateAccessToken(http.HandlerFunc(app.UpdateProfileHandler))).Methods("PATCH")
+	router.Handle("/profile/password", app.validateAccessToken(http.HandlerFunc(app.ChangePasswordHandler))).Methods("POST")
+	router.Handle("/profile/email/verify", app.validateAccessToken(http.HandlerFunc(app.VerifyEmailChangeHandler))).Methods("POST")
+
+	// Two-factor authentication endpoints (require authentication)
+	router.Handle("/2fa", app.validateAccessToken(http.HandlerFunc(app.TwoFactorStatusHandler))).Methods("GET")
+	router.Handle("/2fa/enrol", app.validateAccessToken(http.HandlerFunc(app.EnrolTwoFactorHandler))).Methods("POST")
+	router.Handle("/2fa/enable", app.validateAccessToken(http.HandlerFunc(app.EnableTwoFactorHandler))).Methods("POST")
+	router.Handle("/2fa/disable", app.validateAccessToken(http.HandlerFunc(app.DisableTwoFactorHandler))).Methods("POST")
+	router.Handle("/2fa/recovery-codes", app.validateAccessToken(http.HandlerFunc(app.RegenerateRecoveryCodesHandler))).Methods("POST")
 
 	// Ticket endpoints
 
 	// Create ticket endpoint
-	router.HandleFunc("/tickets", CreateTicketHandler).Methods("POST")
+	router.Handle("/tickets", app.validateAccessToken(http.HandlerFunc(app.CreateTicketHandler))).Methods("POST")
 
 	// Add conversation to ticket endpoint
-	router.HandleFunc("/tickets/{ticketID}/conversation", AddConversationHandler).Methods("POST")
+	router.Handle("/tickets/{ticketID}/conversation", app.validateAccessToken(http.HandlerFunc(app.AddConversationHandler))).Methods("POST")
 
 	// Get all tickets endpoint
-	router.HandleFunc("/tickets", GetTicketsHandler).Methods("GET")
+	router.Handle("/tickets", app.validateAccessToken(http.HandlerFunc(app.GetTicketsHandler))).Methods("GET")
 
 	// Get ticket by ID endpoint
-	router.HandleFunc("/tickets/{ticketID}", GetTicketByIDHandler).Methods("GET")
+	router.Handle("/tickets/{ticketID}", app.validateAccessToken(http.HandlerFunc(app.GetTicketByIDHandler))).Methods("GET")
 
 	// Close ticket endpoint
-	router.HandleFunc("/tickets/{ticketID}", CloseTicketHandler).Methods("DELETE")
+	router.Handle("/tickets/{ticketID}", app.validateAccessToken(http.HandlerFunc(app.CloseTicketHandler))).Methods("DELETE")
+
+	// Reopen closed ticket endpoint
+	router.Handle("/tickets/{ticketID}/reopen", app.validateAccessToken(http.HandlerFunc(app.ReopenTicketHandler))).Methods("POST")
 
-	// Admin endpoints
+	// Change ticket status endpoint
+	router.Handle("/tickets/{ticketID}/status", app.validateAccessToken(http.HandlerFunc(app.UpdateTicketStatusHandler))).Methods("PATCH")
 
-	// View all tickets (requires admin privilege)
-	router.Handle("/admin/tickets", validateAdminAccess(http.HandlerFunc(ViewAllTicketsHandler))).Methods("GET")
+	// Admin endpoints, each requiring a permission of the user's role
+
+	// View all tickets
+	router.Handle("/admin/tickets", app.requirePermission(permTicketReadAny, http.HandlerFunc(app.ViewAllTicketsHandler))).Methods("GET")
+
+	// View the tickets assigned to the requesting admin (registered before /admin/tickets/{ticketID})
+	router.Handle("/admin/tickets/mine", app.requirePermission(permTicketReadAny, http.HandlerFunc(app.MyTicketsHandler))).Methods("GET")
 
 	// Get ticket by ID for admin endpoint
-	router.Handle("/admin/tickets/{ticketID}", validateAdminAccess(http.HandlerFunc(AdminGetTicketByIDHandler))).Methods("GET")
+	router.Handle("/admin/tickets/{ticketID}", app.requirePermission(permTicketReadAny, http.HandlerFunc(app.AdminGetTicketByIDHandler))).Methods("GET")
+
+	// Change ticket status for admin endpoint
+	router.Handle("/admin/tickets/{ticketID}/status", app.requirePermission(permTicketUpdateAny, http.HandlerFunc(app.AdminUpdateTicketStatusHandler))).Methods("PATCH")
+
+	// Change ticket priority for admin endpoint
+	router.Handle("/admin/tickets/{ticketID}/priority", app.requirePermission(permTicketUpdateAny, http.HandlerFunc(app.AdminUpdateTicketPriorityHandler))).Methods("PATCH")
+
+	// Operator availability for automatic assignment
+	router.Handle("/admin/availability", app.requirePermission(permTicketUpdateAny, http.HandlerFunc(app.GetAvailabilityHandler))).Methods("GET")
+	router.Handle("/admin/availability", app.requirePermission(permTicketUpdateAny, http.HandlerFunc(app.UpdateAvailabilityHandler))).Methods("PUT")
+
+	// Ticket assignment endpoints
+	router.Handle("/admin/tickets/{ticketID}/assign", app.requirePermission(permTicketAssign, http.HandlerFunc(app.AssignTicketHandler))).Methods("POST")
+	router.Handle("/admin/tickets/{ticketID}/reassign", app.requirePermission(permTicketAssign, http.HandlerFunc(app.ReassignTicketHandler))).Methods("POST")
+	router.Handle("/admin/tickets/{ticketID}/unassign", app.requirePermission(permTicketAssign, http.HandlerFunc(app.UnassignTicketHandler))).Methods("POST")
+
+	// Permanently delete ticket for admin endpoint
+	router.Handle("/admin/tickets/{ticketID}", app.requirePermission(permTicketDelete, http.HandlerFunc(app.PurgeTicketHandler))).Methods("DELETE")
 
 	// Add conversation to ticket for admin endpoint
-	router.Handle("/admin/tickets/{ticketID}/conversation", validateAdminAccess(http.HandlerFunc(AdminAddConversationHandler))).Methods("POST")
+	router.Handle("/admin/tickets/{ticketID}/conversation", app.requirePermission(permTicketUpdateAny, http.HandlerFunc(app.AdminAddConversationHandler))).Methods("POST")
+
+	// User management for admin endpoint
+	router.Handle("/admin/users", app.requirePermission(permUserManage, http.HandlerFunc(app.ListUsersHandler))).Methods("GET")
+	router.Handle("/admin/users/{userID}", app.requirePermission(permUserManage, http.HandlerFunc(app.GetUserHandler))).Methods("GET")
+	router.Handle("/admin/users/{userID}", app.requirePermission(permUserManage, http.HandlerFunc(app.DeleteUserHandler))).Methods("DELETE")
+	router.Handle("/admin/users/{userID}/deactivate", app.requirePermission(permUserManage, http.HandlerFunc(app.DeactivateUserHandler))).Methods("POST")
+	router.Handle("/admin/users/{userID}/reactivate", app.requirePermission(permUserManage, http.HandlerFunc(app.ReactivateUserHandler))).Methods("POST")
+	router.Handle("/admin/users/{userID}/promote", app.requirePermission(permUserManage, http.HandlerFunc(app.PromoteUserHandler))).Methods("POST")
+	router.Handle("/admin/users/{userID}/demote", app.requirePermission(permUserManage, http.HandlerFunc(app.DemoteUserHandler))).Methods("POST")
+	router.Handle("/admin/users/{userID}/logout", app.requirePermission(permUserManage, http.HandlerFunc(app.ForceLogoutUserHandler))).Methods("POST")
+	router.Handle("/admin/users/{userID}/resend-verification", app.requirePermission(permUserManage, http.HandlerFunc(app.ResendVerificationHandler))).Methods("POST")
+
+	// Short-lived token to see the API as a user
+	router.Handle("/admin/users/{userID}/impersonate", app.requirePermission(permUserImpersonate, http.HandlerFunc(app.ImpersonateUserHandler))).Methods("POST")
+
+	// Lift the lock on an account after too many failed logins
+	router.Handle("/admin/users/{userID}/unlock", app.requirePermission(permUserManage, http.HandlerFunc(app.UnlockUserHandler))).Methods("POST")
+
+	// Role assignments
+	router.Handle("/admin/roles", app.requirePermission(permUserManage, http.HandlerFunc(app.ListRolesHandler))).Methods("GET")
+	router.Handle("/admin/users/{userID}/role", app.requirePermission(permUserManage, http.HandlerFunc(app.SetUserRoleHandler))).Methods("PUT")
+
+	// Ticket report for team leads
+	router.Handle("/admin/reports/tickets", app.requirePermission(permReportView, http.HandlerFunc(app.TicketReportHandler))).Methods("GET")
 
 	// Token refreshing endpoint
-	router.HandleFunc("/tokens/refresh", func(w http.ResponseWriter, r *http.Request) {
-		refreshAccessToken(w, r, r.Header.Get("Authorization"), db)
-	}).Methods("POST")
+	router.HandleFunc("/tokens/refresh", app.RefreshTokenHandler).Methods("POST")
+
+	// Public keys for verifying access tokens (no authentication required)
+	router.HandleFunc("/.well-known/jwks.json", app.JWKSHandler).Methods("GET")
 
 	// Hello, World! endpoint (no authentication required)
 	router.HandleFunc("/", HelloWorldHandler).Methods("GET")
 
-	// Start the server
-	port := 8080
-	log.Printf("Server started on :%d...\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), router))
+	return router
 }
@@ -0,0 +1,153 @@
+// main_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestApp returns an application backed by the in-memory store, with the
+// settings of demo mode: PINs are returned in responses and requests are not
+// rate limited
+func newTestApp(t *testing.T) (*application, *data.MemoryStore) {
+	t.Helper()
+	t.Setenv("JWT_ACCESS_KEY", "test-access-key")
+	t.Setenv("JWT_REFRESH_KEY", "test-refresh-key")
+	t.Setenv("JWT_SIGNING_KEYS", "")
+	t.Setenv("SMTP_HOST", "")
+
+	store := data.NewMemoryStore()
+	accessKeys, refreshKeys, err := loadSigningKeys()
+	if err != nil {
+		t.Fatalf("loading signing keys: %v", err)
+	}
+	revocations, err := newRevocationCache(store)
+	if err != nil {
+		t.Fatalf("creating revocation cache: %v", err)
+	}
+
+	app := &application{
+		store:       store,
+		revocations: revocations,
+		accessKeys:  accessKeys,
+		refreshKeys: refreshKeys,
+
+		loginThrottle: newIPLoginThrottle(),
+
+		echoPins: true,
+	}
+	return app, store
+}
+
+// request sends a request through the routes of the application and returns
+// the response. body is encoded as JSON unless it is nil; token is sent as a
+// bearer token unless it is empty.
+func request(t *testing.T, app *application, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+
+	r := httptest.NewRequest(method, path, &payload)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes a JSON response body
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// registerUser registers and verifies a user, and returns their ID
+func registerUser(t *testing.T, app *application, email, password string) int {
+	t.Helper()
+	w := request(t, app, http.MethodPost, "/register", map[string]string{"email": email, "password": password}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+
+	w = request(t, app, http.MethodPost, "/verify-pin", map[string]string{"email": email, "pin": body["pin"].(string)}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify PIN: status %d: %s", w.Code, w.Body.String())
+	}
+	return int(body["userID"].(float64))
+}
+
+// login logs a user in and returns their access and refresh tokens
+func login(t *testing.T, app *application, email, password string) (string, string) {
+	t.Helper()
+	w := request(t, app, http.MethodPost, "/login", map[string]string{"email": email, "password": password}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	return body["accessToken"].(string), body["refreshToken"].(string)
+}
+
+// registerStaff registers and verifies a user, gives them a staff role and
+// returns their ID and access token
+func registerStaff(t *testing.T, app *application, email, role string) (int, string) {
+	t.Helper()
+	userID := registerUser(t, app, email, "secret")
+	if err := app.store.SetUserRole(userID, role); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	accessToken, _ := login(t, app, email, "secret")
+	return userID, accessToken
+}
+
+// createTicket opens a ticket as the holder of token and returns its ID
+func createTicket(t *testing.T, app *application, token string) int64 {
+	t.Helper()
+	w := request(t, app, http.MethodPost, "/tickets", map[string]string{"subject": "Subject", "issue": "Issue"}, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create ticket: status %d: %s", w.Code, w.Body.String())
+	}
+	return int64(decode(t, w)["TicketID"].(float64))
+}
+
+// recordingStore wraps a store to keep the security events recorded through
+// it, and to fail recording them when failEvents is set
+type recordingStore struct {
+	data.Store
+	events     []data.SecurityEvent
+	failEvents bool
+}
+
+func (s *recordingStore) RecordSecurityEvent(event *data.SecurityEvent) (int64, error) {
+	if s.failEvents {
+		return 0, errors.New("security events are unavailable")
+	}
+	s.events = append(s.events, *event)
+	return s.Store.RecordSecurityEvent(event)
+}
+
+// eventsOfType returns the recorded security events of one type
+func (s *recordingStore) eventsOfType(eventType string) []data.SecurityEvent {
+	var events []data.SecurityEvent
+	for _, event := range s.events {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
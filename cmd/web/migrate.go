@@ -0,0 +1,109 @@
+// migrate.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// migrateUsage describes the migrate subcommand
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate implements the "migrate" subcommand against the store selected by DB_DRIVER
+func runMigrate(args []string) error {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		return errors.New(migrateUsage)
+	}
+
+	store, err := openStore(os.Getenv("DB_DRIVER"))
+	if err != nil {
+		return err
+	}
+	migrator, ok := store.(data.Migrator)
+	if !ok {
+		return errors.New("the selected store has no schema to migrate")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.MigrateUp()
+		fmt.Printf("Applied %d migration(s)\n", applied)
+		return err
+
+	case "down":
+		// Roll back one migration unless a number of steps is given
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.MigrateDown(steps)
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+		return err
+
+	case "status":
+		states, err := migrator.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", state.Version, state.Name, applied)
+		}
+	}
+
+	return nil
+}
+
+// autoMigrateEnabled reports whether pending migrations are applied on startup.
+// DB_AUTO_MIGRATE overrides the default, which is on for SQLite only.
+func autoMigrateEnabled(driver string) bool {
+	if value := os.Getenv("DB_AUTO_MIGRATE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Ignoring invalid DB_AUTO_MIGRATE value %q", value)
+		} else {
+			return enabled
+		}
+	}
+	return driver == "sqlite"
+}
+
+// checkSchema makes sure the store's schema is up to date before the server starts,
+// applying pending migrations when auto-migration is enabled
+func checkSchema(store data.Store, driver string) error {
+	migrator, ok := store.(data.Migrator)
+	if !ok {
+		return nil
+	}
+
+	pending, err := migrator.PendingMigrations()
+	if err != nil {
+		return fmt.Errorf("error checking migrations: %w", err)
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	if !autoMigrateEnabled(driver) {
+		return fmt.Errorf("the database schema is %d migration(s) behind, run \"%s migrate up\" or set DB_AUTO_MIGRATE=true", pending, os.Args[0])
+	}
+
+	applied, err := migrator.MigrateUp()
+	if err != nil {
+		return fmt.Errorf("error applying migrations: %w", err)
+	}
+	log.Printf("Applied %d migration(s)", applied)
+
+	return nil
+}
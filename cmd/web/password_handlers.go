@@ -0,0 +1,183 @@
+// password_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// passwordResetLifetime is how long an emailed password reset token can be used
+const passwordResetLifetime = time.Hour
+
+// forgotPasswordMessage is the response to every password reset request, so
+// that it does not reveal whether an email address is registered
+const forgotPasswordMessage = "If the email address is registered, a password reset code has been sent to it"
+
+// hashToken returns the hex encoded SHA-256 hash under which a token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// passwordResetEmail returns the body of the email carrying a reset token. The
+// email links to PASSWORD_RESET_URL with the token when it is set.
+func passwordResetEmail(token string) string {
+	body := fmt.Sprintf("Use this code to reset your password: %s", token)
+	if resetURL, err := url.Parse(os.Getenv("PASSWORD_RESET_URL")); err == nil && resetURL.String() != "" {
+		query := resetURL.Query()
+		query.Set("token", token)
+		resetURL.RawQuery = query.Encode()
+		body = fmt.Sprintf("Reset your password here: %s", resetURL)
+	}
+
+	return body + fmt.Sprintf("\r\n\r\nThe code can be used once within %d minutes. If you did not ask to reset your password, ignore this email.",
+		int(passwordResetLifetime.Minutes()))
+}
+
+// ForgotPasswordHandler emails a single-use password reset token to a user
+func (app *application) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Respond the same way whether or not the email address is registered
+	respond := func() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": forgotPasswordMessage})
+	}
+
+	user, err := app.store.GetUserByEmail(request.Email)
+	if errors.Is(err, data.ErrUserNotFound) {
+		respond()
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving user for password reset:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the hash of the token is stored
+	token, err := newTokenID()
+	if err != nil {
+		log.Println("Error generating password reset token:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	_, err = app.store.CreatePasswordReset(&data.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetLifetime),
+	})
+	if err != nil {
+		log.Println("Error storing password reset token:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Send the email in the background, so that the response time does not
+	// reveal whether an email was sent
+	go func(email string) {
+		if err := sendEmail(email, "Reset your password", passwordResetEmail(token)); err != nil {
+			log.Println("Error sending password reset email:", err)
+		}
+	}(user.Email)
+
+	respond()
+}
+
+// ResetPasswordHandler sets a new password with an emailed reset token and
+// signs the user out of every session
+func (app *application) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.Token == "" || request.Password == "" {
+		http.Error(w, "Reset token and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	// The token must exist, be unused and not have expired
+	now := time.Now()
+	reset, err := app.store.GetPasswordReset(hashToken(request.Token))
+	if err != nil && !errors.Is(err, data.ErrPasswordResetNotFound) {
+		log.Println("Error retrieving password reset token:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if reset == nil || reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.store.GetUserByID(reset.UserID)
+	if err != nil {
+		log.Println("Error retrieving user for password reset:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Hash the new password the same way as at registration
+	if err := user.SetPassword(request.Password); err != nil {
+		log.Println("Error hashing password:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Use up this and any other outstanding token of the user
+	if err := app.store.UsePasswordResets(user.ID, now); err != nil {
+		if errors.Is(err, data.ErrPasswordResetNotFound) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		log.Println("Error using password reset token:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.store.UpdatePassword(user.ID, user.Password); err != nil {
+		log.Println("Error updating password:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Sign the user out everywhere, which also invalidates their refresh tokens
+	if _, err := app.store.RevokeOtherSessions(user.ID, 0, now); err != nil {
+		log.Println("Error revoking sessions after password reset:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	app.revocations.forgetUser(user.ID)
+
+	app.recordSecurityEvent(r, user.ID, data.SecurityEventPasswordReset,
+		"The password was reset with an emailed token; all sessions were revoked")
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Password reset successfully"})
+}
@@ -0,0 +1,109 @@
+// password_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// resetCountingStore counts the password reset tokens that are stored
+type resetCountingStore struct {
+	data.Store
+	resets []*data.PasswordReset
+}
+
+func (s *resetCountingStore) CreatePasswordReset(reset *data.PasswordReset) (int64, error) {
+	s.resets = append(s.resets, reset)
+	return s.Store.CreatePasswordReset(reset)
+}
+
+// addPasswordReset stores a reset token for a user, as if it had been emailed
+func addPasswordReset(t *testing.T, store data.Store, userID int, token string, expiresAt time.Time) {
+	t.Helper()
+	_, err := store.CreatePasswordReset(&data.PasswordReset{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		CreatedAt: expiresAt.Add(-passwordResetLifetime),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("CreatePasswordReset: %v", err)
+	}
+}
+
+func TestForgotPasswordHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	resets := &resetCountingStore{Store: store}
+	app.store = resets
+	userID := registerUser(t, app, "user@example.com", "secret")
+
+	// The response does not tell whether the email address is registered
+	unknown := request(t, app, http.MethodPost, "/password/forgot", map[string]string{"email": "nobody@example.com"}, "")
+	known := request(t, app, http.MethodPost, "/password/forgot", map[string]string{"email": "user@example.com"}, "")
+	if unknown.Code != http.StatusOK || known.Code != http.StatusOK {
+		t.Fatalf("status %d for an unknown email and %d for a registered one, want %d", unknown.Code, known.Code, http.StatusOK)
+	}
+	if unknown.Body.String() != known.Body.String() {
+		t.Errorf("responses differ: %q for an unknown email, %q for a registered one", unknown.Body.String(), known.Body.String())
+	}
+
+	if len(resets.resets) != 1 || resets.resets[0].UserID != userID {
+		t.Errorf("stored resets = %+v, want one for the registered user", resets.resets)
+	}
+
+	if w := request(t, app, http.MethodPost, "/password/forgot", map[string]string{}, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("no email: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	firstToken, _ := login(t, app, "user@example.com", "secret")
+	secondToken, _ := login(t, app, "user@example.com", "secret")
+	addPasswordReset(t, store, userID, "valid-token", time.Now().Add(passwordResetLifetime))
+	addPasswordReset(t, store, userID, "other-token", time.Now().Add(passwordResetLifetime))
+	addPasswordReset(t, store, userID, "expired-token", time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"unknown token", "unknown-token", http.StatusBadRequest},
+		{"expired token", "expired-token", http.StatusBadRequest},
+		{"no token", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := request(t, app, http.MethodPost, "/password/reset", map[string]string{"token": tt.token, "password": "new-secret"}, ""); w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.code)
+		}
+	}
+
+	if w := request(t, app, http.MethodPost, "/password/reset", map[string]string{"token": "valid-token", "password": "new-secret"}, ""); w.Code != http.StatusOK {
+		t.Fatalf("reset: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// Every session of the user was signed out
+	for _, token := range []string{firstToken, secondToken} {
+		if w := request(t, app, http.MethodGet, "/profile", nil, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("session after the reset: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Only the new password works
+	if w := request(t, app, http.MethodPost, "/login", map[string]string{"email": "user@example.com", "password": "secret"}, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with the old password: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	login(t, app, "user@example.com", "new-secret")
+
+	// The token, and every other outstanding token of the user, is used up
+	for _, token := range []string{"valid-token", "other-token"} {
+		if w := request(t, app, http.MethodPost, "/password/reset", map[string]string{"token": token, "password": "third-secret"}, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s after the reset: status %d, want %d", token, w.Code, http.StatusBadRequest)
+		}
+	}
+}
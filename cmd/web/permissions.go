@@ -0,0 +1,46 @@
+// permissions.go
+
+package main
+
+import "backend-project/data"
+
+// Permissions checked by the API. Roles are granted a fixed set of them.
+const (
+	// permTicketReadAny allows reading every ticket, not just one's own
+	permTicketReadAny = "ticket.read.any"
+	// permTicketUpdateAny allows answering, prioritising and changing the
+	// status of any ticket, and setting one's availability for assignment
+	permTicketUpdateAny = "ticket.update.any"
+	// permTicketAssign allows assigning tickets to operators
+	permTicketAssign = "ticket.assign"
+	// permTicketDelete allows deleting tickets permanently
+	permTicketDelete = "ticket.delete"
+	// permUserManage allows managing users and their roles
+	permUserManage = "user.manage"
+	// permUserImpersonate allows getting a token to act as another user
+	permUserImpersonate = "user.impersonate"
+	// permReportView allows viewing reports
+	permReportView = "report.view"
+)
+
+// rolePermissions lists the permissions granted to each role
+var rolePermissions = map[string][]string{
+	data.RoleCustomer: {},
+	data.RoleAgent:    {permTicketReadAny, permTicketUpdateAny},
+	data.RoleSupervisor: {
+		permTicketReadAny, permTicketUpdateAny, permTicketAssign, permReportView,
+	},
+	data.RoleAdmin: {
+		permTicketReadAny, permTicketUpdateAny, permTicketAssign, permTicketDelete, permUserManage, permUserImpersonate, permReportView,
+	},
+}
+
+// rolePermits reports whether a role is granted a permission
+func rolePermits(role, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
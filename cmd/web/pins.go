@@ -0,0 +1,166 @@
+// pins.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// PIN limits. A PIN that was entered wrongly maxPinAttempts times cannot be
+// replaced until pinLockout after it was sent, which bounds guessing to
+// maxPinAttempts guesses per pinLockout.
+const (
+	pinLifetime       = 15 * time.Minute
+	pinResendCooldown = time.Minute
+	pinLockout        = 15 * time.Minute
+	maxPinAttempts    = 5
+)
+
+var (
+	// errPinExpired is returned when a PIN is entered after it expired
+	errPinExpired = errors.New("PIN expired")
+	// errPinIncorrect is returned when the PIN entered is wrong
+	errPinIncorrect = errors.New("incorrect PIN")
+)
+
+// pinCooldownError is returned when a new PIN is asked for too soon after the last one
+type pinCooldownError struct {
+	retryAfter time.Duration
+}
+
+func (e *pinCooldownError) Error() string {
+	return fmt.Sprintf("a new PIN can be sent in %s", e.retryAfter)
+}
+
+// pinEchoEnabled reads PIN_IN_RESPONSE, which makes the API return the PINs
+// it emails so that it can be tried without a mailbox. Development only.
+func pinEchoEnabled() (bool, error) {
+	value := os.Getenv("PIN_IN_RESPONSE")
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid PIN_IN_RESPONSE: %w", err)
+	}
+	if enabled {
+		log.Println("PIN_IN_RESPONSE is set: PINs are returned in API responses. Never enable this in production")
+	}
+	return enabled, nil
+}
+
+// issuePin generates a new PIN for the user and purpose, replacing the
+// previous one, and returns it to be emailed. It returns a *pinCooldownError
+// when the previous PIN was sent too recently.
+func (app *application) issuePin(userID int, purpose string) (string, error) {
+	now := time.Now()
+	if err := app.checkPinCooldown(userID, purpose, now); err != nil {
+		return "", err
+	}
+
+	// Generate a pin number for verification
+	pinNumber, err := data.GeneratePinNumber()
+	if err != nil {
+		return "", err
+	}
+
+	pin := &data.VerificationPin{
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(pinLifetime),
+	}
+	if err := pin.SetPin(pinNumber); err != nil {
+		return "", err
+	}
+	if _, err := app.store.ReplaceVerificationPin(pin); err != nil {
+		return "", err
+	}
+
+	return pinNumber, nil
+}
+
+// checkPinCooldown returns a *pinCooldownError when a new PIN for the user and
+// purpose cannot be issued yet, because the previous one was sent too recently
+func (app *application) checkPinCooldown(userID int, purpose string, now time.Time) error {
+	previous, err := app.store.GetVerificationPin(userID, purpose)
+	if err != nil && !errors.Is(err, data.ErrVerificationPinNotFound) {
+		return err
+	}
+	if previous != nil {
+		cooldown := pinResendCooldown
+		if previous.Attempts >= maxPinAttempts {
+			cooldown = pinLockout
+		}
+		if wait := previous.CreatedAt.Add(cooldown).Sub(now); wait > 0 {
+			return &pinCooldownError{retryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// checkPin checks a PIN entered by the user for the given purpose. Every
+// attempt counts towards maxPinAttempts, whether or not the PIN is right.
+// The caller deletes the PIN once it has acted on it.
+func (app *application) checkPin(userID int, purpose, entered string) error {
+	pin, err := app.store.GetVerificationPin(userID, purpose)
+	if err != nil {
+		return err
+	}
+	if !time.Now().Before(pin.ExpiresAt) {
+		return errPinExpired
+	}
+
+	// Claim an attempt before comparing, so that the limit holds under concurrent guesses
+	if err := app.store.RecordPinAttempt(pin.ID, maxPinAttempts); err != nil {
+		return err
+	}
+
+	matches, err := pin.PinMatches(entered)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return errPinIncorrect
+	}
+	return nil
+}
+
+// writePinError responds to a PIN that was not accepted. incorrectStatus is
+// the status for a wrong PIN. It reports false for unexpected errors, which
+// the caller handles.
+func writePinError(w http.ResponseWriter, err error, incorrectStatus int) bool {
+	switch {
+	case errors.Is(err, errPinIncorrect):
+		http.Error(w, "Invalid PIN", incorrectStatus)
+	case errors.Is(err, errPinExpired):
+		http.Error(w, "PIN has expired, request a new one", http.StatusBadRequest)
+	case errors.Is(err, data.ErrVerificationPinNotFound):
+		http.Error(w, "No PIN to verify, request a new one", http.StatusBadRequest)
+	case errors.Is(err, data.ErrPinAttemptsExceeded):
+		http.Error(w, "Too many incorrect attempts, request a new PIN", http.StatusTooManyRequests)
+	default:
+		return false
+	}
+	return true
+}
+
+// writePinCooldown responds to a request for a new PIN made too soon. It
+// reports false when err is not a *pinCooldownError.
+func writePinCooldown(w http.ResponseWriter, err error) bool {
+	var cooldown *pinCooldownError
+	if !errors.As(err, &cooldown) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.retryAfter.Seconds()))))
+	http.Error(w, "A new PIN was sent recently, try again later", http.StatusTooManyRequests)
+	return true
+}
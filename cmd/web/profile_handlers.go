@@ -0,0 +1,324 @@
+// profile_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// userProfile is a user as returned by the API. It leaves out the password
+// hash, PIN and refresh token, which must never leave the server.
+type userProfile struct {
+	ID         int
+	Email      string
+	FirstName  string
+	LastName   string
+	UserActive int
+	IsAdmin    int
+	Role       string
+}
+
+// newUserProfile returns the profile of a user
+func newUserProfile(user *data.User) userProfile {
+	return userProfile{
+		ID:         user.ID,
+		Email:      user.Email,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		UserActive: user.UserActive,
+		IsAdmin:    user.IsAdmin,
+		Role:       user.Role,
+	}
+}
+
+// recordSecurityEvent records a security event caused by the request.
+// Failures are logged, as the action it describes has already happened.
+func (app *application) recordSecurityEvent(r *http.Request, userID int, eventType, details string) {
+	app.saveSecurityEvent(r, &data.SecurityEvent{UserID: userID, Type: eventType, Details: details})
+}
+
+// saveSecurityEvent stores a security event with the client details and
+// time of the request that caused it. Failures are logged and returned.
+func (app *application) saveSecurityEvent(r *http.Request, event *data.SecurityEvent) error {
+	event.IPAddress = clientIP(r)
+	event.UserAgent = truncateUserAgent(r.UserAgent())
+	event.CreatedAt = time.Now()
+	if _, err := app.store.RecordSecurityEvent(event); err != nil {
+		log.Printf("Failed to record security event for user %d: %v", event.UserID, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateProfileHandler updates the name of the authenticated user and starts
+// a change of their email address, which takes effect once the PIN sent to
+// the new address is verified
+func (app *application) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Updating user profile...")
+
+	var request struct {
+		FirstName *string `json:"firstName"`
+		LastName  *string `json:"lastName"`
+		Email     *string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.store.GetUserByID(principalFrom(r).UserID)
+	if err != nil {
+		log.Println("Error retrieving user profile:", err)
+		http.Error(w, "Error retrieving user profile", http.StatusInternalServerError)
+		return
+	}
+
+	// Validate the new email address before changing anything
+	var newEmail string
+	if request.Email != nil && !strings.EqualFold(strings.TrimSpace(*request.Email), user.Email) {
+		newEmail = strings.TrimSpace(*request.Email)
+		if address, err := mail.ParseAddress(newEmail); err != nil || address.Address != newEmail {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		exists, err := app.store.UserExists(newEmail)
+		if err != nil {
+			log.Println("Error checking user existence:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			http.Error(w, "Email address already in use", http.StatusConflict)
+			return
+		}
+	}
+
+	// Record the new email address before its PIN is issued, so that the PIN
+	// always belongs to the address that is pending. A change refused because
+	// the previous PIN was sent too recently leaves the earlier one in place.
+	var pin string
+	if newEmail != "" {
+		if err := app.checkPinCooldown(user.ID, data.PinPurposeEmailChange, time.Now()); err != nil {
+			if writePinCooldown(w, err) {
+				return
+			}
+			log.Println("Error checking PIN cooldown:", err)
+			http.Error(w, "Error generating pin number", http.StatusInternalServerError)
+			return
+		}
+		if err := app.store.SetPendingEmail(user.ID, newEmail); err != nil {
+			log.Println("Error storing pending email:", err)
+			http.Error(w, "Error updating user profile", http.StatusInternalServerError)
+			return
+		}
+		if pin, err = app.issuePin(user.ID, data.PinPurposeEmailChange); err != nil {
+			// The PIN sent for an earlier address must not confirm this one
+			if err := app.store.SetPendingEmail(user.ID, ""); err != nil {
+				log.Println("Error withdrawing pending email:", err)
+			}
+			if writePinCooldown(w, err) {
+				return
+			}
+			log.Println("Error generating pin number:", err)
+			http.Error(w, "Error generating pin number", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update the name
+	if request.FirstName != nil || request.LastName != nil {
+		if request.FirstName != nil {
+			user.FirstName = *request.FirstName
+		}
+		if request.LastName != nil {
+			user.LastName = *request.LastName
+		}
+		if err := app.store.UpdateUserName(user.ID, user.FirstName, user.LastName); err != nil {
+			log.Println("Error updating user name:", err)
+			http.Error(w, "Error updating user profile", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]interface{}{"message": "Profile updated successfully"}
+
+	// Send the PIN to the new email address; the change waits for its verification
+	if newEmail != "" {
+		if err := sendPinByEmail(newEmail, pin); err != nil {
+			log.Println("Error sending PIN via email:", err)
+			http.Error(w, "Error sending PIN via email", http.StatusInternalServerError)
+			return
+		}
+
+		response["message"] = "Profile updated successfully. Verify the PIN sent to the new email address to change it"
+		response["pendingEmail"] = newEmail
+		if app.echoPins {
+			response["pin"] = pin
+		}
+	}
+
+	response["user"] = newUserProfile(user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// VerifyEmailChangeHandler completes a change of email address with the PIN
+// sent to the new address
+func (app *application) VerifyEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Verifying email change...")
+
+	var request struct {
+		Pin string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID := principalFrom(r).UserID
+	newEmail, err := app.store.GetPendingEmail(userID)
+	if errors.Is(err, data.ErrNoPendingEmail) {
+		http.Error(w, "No email change to verify", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving pending email:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.checkPin(userID, data.PinPurposeEmailChange, request.Pin); err != nil {
+		if writePinError(w, err, http.StatusBadRequest) {
+			return
+		}
+		log.Println("Error checking PIN:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The address may have been registered since the change was requested
+	exists, err := app.store.UserExists(newEmail)
+	if err != nil {
+		log.Println("Error checking user existence:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "Email address already in use", http.StatusConflict)
+		return
+	}
+
+	oldEmail, err := app.store.GetUserEmailByID(userID)
+	if err != nil {
+		log.Println("Error retrieving user email:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.store.ConfirmPendingEmail(userID, newEmail); err != nil {
+		if errors.Is(err, data.ErrNoPendingEmail) {
+			http.Error(w, "The email change was replaced by a newer one", http.StatusConflict)
+			return
+		}
+		log.Println("Error changing email address:", err)
+		http.Error(w, "Error changing email address", http.StatusInternalServerError)
+		return
+	}
+	if err := app.store.DeleteVerificationPin(userID, data.PinPurposeEmailChange); err != nil {
+		log.Println("Error deleting used PIN:", err)
+	}
+
+	app.recordSecurityEvent(r, userID, data.SecurityEventEmailChange,
+		fmt.Sprintf("The email address was changed from %s to %s", oldEmail, newEmail))
+
+	// Let the previous address know, in case the change was not made by its owner
+	body := fmt.Sprintf("The email address of your account was changed to %s. If you did not make this change, contact support.", newEmail)
+	if err := sendEmail(oldEmail, "Your email address was changed", body); err != nil {
+		log.Println("Error sending email change notification:", err)
+	}
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Email address changed successfully",
+		"email":   newEmail,
+	})
+}
+
+// ChangePasswordHandler changes the password of the authenticated user, who
+// must confirm their current password. Every other session is signed out.
+func (app *application) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Changing password...")
+
+	var request struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.CurrentPassword == "" || request.NewPassword == "" {
+		http.Error(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	p := principalFrom(r)
+	user, err := app.store.GetUserByID(p.UserID)
+	if err != nil {
+		log.Println("Error retrieving user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := user.PasswordMatches(request.CurrentPassword)
+	if err != nil {
+		log.Println("Error comparing passwords:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !matches {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	// Hash the new password the same way as at registration
+	if err := user.SetPassword(request.NewPassword); err != nil {
+		log.Println("Error hashing password:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.store.UpdatePassword(user.ID, user.Password); err != nil {
+		log.Println("Error updating password:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Sign out the other sessions, which may have been opened with the old password
+	revoked, err := app.store.RevokeOtherSessions(user.ID, p.SessionID, time.Now())
+	if err != nil {
+		log.Println("Error revoking sessions after password change:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	app.revocations.forgetUser(user.ID)
+
+	app.recordSecurityEvent(r, user.ID, data.SecurityEventPasswordChange,
+		"The password was changed; other sessions were revoked")
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "Password changed successfully",
+		"revokedSessions": revoked,
+	})
+}
@@ -0,0 +1,90 @@
+// profile_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateUserNameAndPendingEmail(t *testing.T) {
+	for name, store := range testStores(t) {
+		userID := createTestUser(t, store, "user@example.com", data.RoleCustomer)
+
+		// Saving the values a user already has is not a missing user
+		for i := 0; i < 2; i++ {
+			if err := store.UpdateUserName(userID, "Nina", "New"); err != nil {
+				t.Errorf("%s: UpdateUserName %d: %v", name, i+1, err)
+			}
+			if err := store.SetPendingEmail(userID, "new@example.com"); err != nil {
+				t.Errorf("%s: SetPendingEmail %d: %v", name, i+1, err)
+			}
+		}
+		if pending, err := store.GetPendingEmail(userID); err != nil || pending != "new@example.com" {
+			t.Errorf("%s: pending email = %q, %v", name, pending, err)
+		}
+
+		// An empty address withdraws the change
+		if err := store.SetPendingEmail(userID, ""); err != nil {
+			t.Errorf("%s: withdrawing the pending email: %v", name, err)
+		}
+		if _, err := store.GetPendingEmail(userID); !errors.Is(err, data.ErrNoPendingEmail) {
+			t.Errorf("%s: withdrawn pending email: error = %v, want %v", name, err, data.ErrNoPendingEmail)
+		}
+
+		if err := store.UpdateUserName(userID+100, "Nina", "New"); !errors.Is(err, data.ErrUserNotFound) {
+			t.Errorf("%s: unknown user: error = %v, want %v", name, err, data.ErrUserNotFound)
+		}
+	}
+}
+
+func TestUpdateProfileHandler(t *testing.T) {
+	app, store := newTestApp(t)
+	userID := registerUser(t, app, "user@example.com", "secret")
+	accessToken, _ := login(t, app, "user@example.com", "secret")
+
+	// Saving the same name twice succeeds both times
+	for i := 0; i < 2; i++ {
+		w := request(t, app, http.MethodPatch, "/profile", map[string]string{"firstName": "Nina", "lastName": "New"}, accessToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("update %d: status %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	// A change of email address waits for the PIN sent to the new address
+	w := request(t, app, http.MethodPatch, "/profile", map[string]string{"email": "first@example.com"}, accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("email change: status %d: %s", w.Code, w.Body.String())
+	}
+	pin, _ := decode(t, w)["pin"].(string)
+	if pin == "" {
+		t.Fatal("the PIN was not returned with PIN_IN_RESPONSE set")
+	}
+
+	// Asking for another address before a new PIN can be sent keeps the first one pending
+	w = request(t, app, http.MethodPatch, "/profile", map[string]string{"email": "second@example.com"}, accessToken)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("second email change: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if pending, err := store.GetPendingEmail(userID); err != nil || pending != "first@example.com" {
+		t.Errorf("pending email = %q, %v, want first@example.com", pending, err)
+	}
+
+	w = request(t, app, http.MethodPost, "/profile/email/verify", map[string]string{"pin": pin}, accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify email change: status %d: %s", w.Code, w.Body.String())
+	}
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Email != "first@example.com" || user.FirstName != "Nina" || user.LastName != "New" {
+		t.Errorf("profile = %s %s <%s>", user.FirstName, user.LastName, user.Email)
+	}
+
+	if w := request(t, app, http.MethodPatch, "/profile", map[string]string{"email": "not an address"}, accessToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid email: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
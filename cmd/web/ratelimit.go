@@ -0,0 +1,196 @@
+// ratelimit.go
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rateLimitBucketLimit is the number of buckets above which full ones are dropped
+const rateLimitBucketLimit = 10000
+
+// rateLimit is a token bucket policy: a client may make up to requests
+// requests at once, and the bucket refills at requests per window
+type rateLimit struct {
+	name     string
+	requests int
+	window   time.Duration
+}
+
+var (
+	// authRateLimit applies to the endpoints that check passwords, PINs and
+	// codes or send emails
+	authRateLimit = rateLimit{name: "auth", requests: 10, window: time.Minute}
+	// messageRateLimit applies to creating tickets and adding messages, which
+	// operators have to read
+	messageRateLimit = rateLimit{name: "messages", requests: 10, window: time.Minute}
+	// writeRateLimit applies to the other requests that change something
+	writeRateLimit = rateLimit{name: "write", requests: 60, window: time.Minute}
+	// readRateLimit applies to the other requests
+	readRateLimit = rateLimit{name: "read", requests: 300, window: time.Minute}
+)
+
+// routeRateLimits holds the policies of routes that do not use the default
+// one for their method, keyed by method and path template
+var routeRateLimits = map[string]rateLimit{
+	"POST /register":                        authRateLimit,
+	"POST /verify-pin":                      authRateLimit,
+	"POST /verify-pin/resend":               authRateLimit,
+	"POST /login":                           authRateLimit,
+	"POST /login/2fa":                       authRateLimit,
+	"POST /password/forgot":                 authRateLimit,
+	"POST /password/reset":                  authRateLimit,
+	"POST /tickets":                         messageRateLimit,
+	"POST /tickets/{ticketID}/conversation": messageRateLimit,
+}
+
+// rateLimitFor returns the policy of the route a request matched
+func rateLimitFor(r *http.Request) rateLimit {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if limit, ok := routeRateLimits[r.Method+" "+template]; ok {
+				return limit
+			}
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return readRateLimit
+	}
+	return writeRateLimit
+}
+
+// rateLimitResult is the state of a bucket after a request took from it
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int           // whole requests left in the bucket
+	retryAfter time.Duration // until the next request is allowed, when refused
+	reset      time.Duration // until the bucket is full again
+}
+
+// rateLimitStore keeps the token buckets of the rate limiter. The in-memory
+// store limits every instance on its own; a store shared by the instances
+// would limit them together.
+type rateLimitStore interface {
+	// take removes a token from the bucket under key, refilled as limit
+	// allows since it was last used, and reports the bucket afterwards
+	take(key string, limit rateLimit, now time.Time) (rateLimitResult, error)
+}
+
+// tokenBucket is the state of one bucket of the in-memory store
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// memoryRateLimitStore keeps token buckets in memory
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newMemoryRateLimitStore returns an in-memory store without buckets
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// take removes a token from the bucket under key
+func (s *memoryRateLimitStore) take(key string, limit rateLimit, now time.Time) (rateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capacity := float64(limit.requests)
+	perSecond := capacity / limit.window.Seconds()
+
+	// A bucket that has refilled completely is the same as a new one
+	if len(s.buckets) >= rateLimitBucketLimit {
+		for k, b := range s.buckets {
+			if b.tokens+now.Sub(b.updatedAt).Seconds()*perSecond >= capacity {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updatedAt: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*perSecond)
+	bucket.updatedAt = now
+
+	result := rateLimitResult{allowed: bucket.tokens >= 1}
+	if result.allowed {
+		bucket.tokens--
+	} else {
+		result.retryAfter = time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+	result.remaining = int(bucket.tokens)
+	result.reset = time.Duration((capacity - bucket.tokens) / perSecond * float64(time.Second))
+	return result, nil
+}
+
+// newRateLimitStore reads the rate limiting settings from the environment.
+// It returns nil when RATE_LIMIT_ENABLED is false, which turns rate limiting off.
+func newRateLimitStore() (rateLimitStore, error) {
+	if value := os.Getenv("RATE_LIMIT_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			log.Println("WARNING: RATE_LIMIT_ENABLED is false, requests are not rate limited")
+			return nil, nil
+		}
+	}
+	return newMemoryRateLimitStore(), nil
+}
+
+// rateLimitKey returns the client a request is counted against: the user of
+// a valid access token, or else the client IP address
+func (app *application) rateLimitKey(r *http.Request) string {
+	if accessToken := bearerToken(r); accessToken != "" {
+		if claims, err := app.parseAccessToken(accessToken); err == nil {
+			if userID, err := claims.userID(); err == nil {
+				return fmt.Sprintf("user:%d", userID)
+			}
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// rateLimitRequests refuses requests beyond the policy of their route with
+// 429 and a Retry-After header, and describes the policy in RateLimit-*
+// headers on every response
+func (app *application) rateLimitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := rateLimitFor(r)
+		result, err := app.rateLimits.take(limit.name+":"+app.rateLimitKey(r), limit, time.Now())
+		if err != nil {
+			// Serve the request rather than fail every request with the store
+			log.Println("Failed to check rate limit:", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.requests, int(limit.window.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+		if !result.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.retryAfter.Seconds()))))
+			http.Error(w, "Too many requests. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+// ratelimit_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	limit := rateLimit{name: "test", requests: 2, window: 10 * time.Second}
+	now := time.Now()
+
+	for i := 0; i < limit.requests; i++ {
+		if result, _ := store.take("key", limit, now); !result.allowed || result.remaining != limit.requests-1-i {
+			t.Fatalf("request %d: %+v", i+1, result)
+		}
+	}
+	result, _ := store.take("key", limit, now)
+	if result.allowed || result.retryAfter != 5*time.Second || result.reset != 10*time.Second {
+		t.Errorf("request beyond the limit: %+v", result)
+	}
+
+	// Other keys have buckets of their own
+	if result, _ := store.take("other", limit, now); !result.allowed {
+		t.Error("another key was refused")
+	}
+
+	// The bucket refills at requests per window
+	if result, _ := store.take("key", limit, now.Add(5*time.Second)); !result.allowed || result.remaining != 0 {
+		t.Errorf("after refilling one request: %+v", result)
+	}
+}
+
+// requestFrom sends a request from a client IP address and returns the response
+func requestFrom(app *application, method, path, body, ip, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = ip + ":1234"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitRequestsByIP(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.rateLimits = newMemoryRateLimitStore()
+	body := `{"email": "nobody@example.com"}`
+
+	for i := 0; i < authRateLimit.requests; i++ {
+		w := requestFrom(app, http.MethodPost, "/password/forgot", body, "192.0.2.1", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Policy"); got != "10;w=60" {
+			t.Errorf("RateLimit-Policy = %q, want %q", got, "10;w=60")
+		}
+	}
+
+	w := requestFrom(app, http.MethodPost, "/password/forgot", body, "192.0.2.1", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request beyond the limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "6" {
+		t.Errorf("Retry-After = %q, want %q", got, "6")
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want %q", got, "0")
+	}
+
+	// The other policies and other clients are counted separately
+	if w := requestFrom(app, http.MethodPost, "/password/forgot", body, "192.0.2.2", ""); w.Code != http.StatusOK {
+		t.Errorf("another IP address: status %d, want %d", w.Code, http.StatusOK)
+	}
+	w = requestFrom(app, http.MethodGet, "/tickets", "", "192.0.2.1", "")
+	if w.Code == http.StatusTooManyRequests {
+		t.Error("a read was refused after the authentication limit was reached")
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "300" {
+		t.Errorf("RateLimit-Limit of a read = %q, want %q", got, "300")
+	}
+}
+
+func TestRateLimitRequestsByUser(t *testing.T) {
+	app, _ := newTestApp(t)
+	registerUser(t, app, "first@example.com", "secret")
+	firstToken, _ := login(t, app, "first@example.com", "secret")
+	registerUser(t, app, "second@example.com", "secret")
+	secondToken, _ := login(t, app, "second@example.com", "secret")
+	app.rateLimits = newMemoryRateLimitStore()
+	body := `{"subject": "Subject", "issue": "Issue"}`
+
+	// Signed-in users are counted wherever they send requests from
+	for i := 0; i < messageRateLimit.requests; i++ {
+		ip := "192.0.2.1"
+		if i%2 == 1 {
+			ip = "192.0.2.2"
+		}
+		if w := requestFrom(app, http.MethodPost, "/tickets", body, ip, firstToken); w.Code != http.StatusOK {
+			t.Fatalf("ticket %d: status %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	if w := requestFrom(app, http.MethodPost, "/tickets", body, "192.0.2.3", firstToken); w.Code != http.StatusTooManyRequests {
+		t.Errorf("ticket beyond the limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// Other users from the same address are not
+	if w := requestFrom(app, http.MethodPost, "/tickets", body, "192.0.2.1", secondToken); w.Code != http.StatusOK {
+		t.Errorf("another user: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,59 @@
+// report_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ticketReport summarises the tickets for team leads
+type ticketReport struct {
+	Total      int            `json:"total"`      // Number of tickets
+	Open       int            `json:"open"`       // Number of tickets that are neither resolved nor closed
+	Unassigned int            `json:"unassigned"` // Number of open tickets without an operator
+	ByStatus   map[string]int `json:"byStatus"`   // Number of tickets per status
+	ByPriority map[string]int `json:"byPriority"` // Number of open tickets per priority
+	ByAssignee map[string]int `json:"byAssignee"` // Number of open tickets per operator ID
+}
+
+// TicketReportHandler reports how many tickets there are per status,
+// priority and operator
+func (app *application) TicketReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Reporting on tickets...")
+
+	// Fetch the tickets from the database
+	tickets, err := app.store.GetTickets()
+	if err != nil {
+		http.Error(w, "Failed to fetch tickets.", http.StatusInternalServerError)
+		return
+	}
+
+	report := ticketReport{
+		Total:      len(tickets),
+		ByStatus:   make(map[string]int),
+		ByPriority: make(map[string]int),
+		ByAssignee: make(map[string]int),
+	}
+	for _, ticket := range tickets {
+		report.ByStatus[ticket.Status]++
+		if ticket.Status == data.TicketStatusResolved || ticket.Status == data.TicketStatusClosed {
+			continue
+		}
+		report.Open++
+		report.ByPriority[ticket.Priority]++
+		if ticket.AssignedTo == nil {
+			report.Unassigned++
+		} else {
+			report.ByAssignee[strconv.FormatInt(*ticket.AssignedTo, 10)]++
+		}
+	}
+
+	// Serialize the report to JSON and send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,129 @@
+// revocation.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRevocationCacheTTL is how long a revocation check result is reused
+const defaultRevocationCacheTTL = 30 * time.Second
+
+// revocationCacheLimit is the number of cached results above which expired entries are dropped
+const revocationCacheLimit = 10000
+
+// revocationEntry is a cached revocation check result
+type revocationEntry struct {
+	userID    int
+	revoked   bool
+	checkedAt time.Time
+}
+
+// revocationCache checks whether the session an access token was issued for
+// is still active, caching each answer for a short time. Sessions are revoked
+// when the user logs out or revokes them from another session.
+type revocationCache struct {
+	sessions data.SessionStore
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[int64]revocationEntry // keyed by session ID
+}
+
+// newRevocationCache reads the revocation settings from the environment.
+// It returns nil when AUTH_REVOCATION_CHECK is false, which turns the check off.
+func newRevocationCache(sessions data.SessionStore) (*revocationCache, error) {
+	if value := os.Getenv("AUTH_REVOCATION_CHECK"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			return nil, nil
+		}
+	}
+
+	ttl := defaultRevocationCacheTTL
+	if value := os.Getenv("AUTH_REVOCATION_CACHE_TTL"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &revocationCache{
+		sessions: sessions,
+		ttl:      ttl,
+		entries:  make(map[int64]revocationEntry),
+	}, nil
+}
+
+// isRevoked reports whether the session of an access token issued to userID
+// has been revoked or has expired. Each check that reaches the database also
+// records the session as recently used.
+func (c *revocationCache) isRevoked(sessionID int64, userID int) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[sessionID]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.checkedAt) < c.ttl {
+		return entry.revoked, nil
+	}
+
+	session, err := c.sessions.GetSession(sessionID)
+	if err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+		return false, err
+	}
+	revoked := session == nil || session.UserID != userID || !session.Active(now)
+	if !revoked {
+		if err := c.sessions.TouchSession(sessionID, now); err != nil {
+			return false, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= revocationCacheLimit {
+		for k, e := range c.entries {
+			if now.Sub(e.checkedAt) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[sessionID] = revocationEntry{userID: userID, revoked: revoked, checkedAt: now}
+
+	return revoked, nil
+}
+
+// forget drops the cached result for a session, so that revoking it on this
+// instance takes effect immediately
+func (c *revocationCache) forget(sessionID int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, sessionID)
+}
+
+// forgetUser drops the cached results for every session of a user
+func (c *revocationCache) forgetUser(userID int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for sessionID, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, sessionID)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// session_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxUserAgentLength is the longest user agent stored with a session
+const maxUserAgentLength = 255
+
+// sessionView is a session as listed to its user
+type sessionView struct {
+	data.Session
+	Current bool `json:"current"` // Whether the request was made from this session
+}
+
+// clientIP returns the IP address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// truncateUserAgent shortens a user agent to the length stored in the
+// database, cutting before a character rather than through one
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	cut := maxUserAgentLength
+	for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+		cut--
+	}
+	return userAgent[:cut]
+}
+
+// startSession records a new login of the user from the client making the
+// request, with the ID of its first refresh token. twoFactor records whether
+// the login was confirmed with a second factor.
+func (app *application) startSession(r *http.Request, userID int, twoFactor bool) (*data.Session, error) {
+	refreshTokenID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &data.Session{
+		UserID:         userID,
+		UserAgent:      truncateUserAgent(r.UserAgent()),
+		IPAddress:      clientIP(r),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(refreshTokenLifetime),
+		TwoFactor:      twoFactor,
+		RefreshTokenID: refreshTokenID,
+	}
+	if session.ID, err = app.store.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessionsHandler lists the active sessions of the authenticated user
+func (app *application) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Listing sessions...")
+
+	p := principalFrom(r)
+	sessions, err := app.store.GetSessionsByUserID(p.UserID, time.Now())
+	if err != nil {
+		log.Println("Failed to retrieve sessions:", err)
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, sessionView{Session: session, Current: session.ID == p.SessionID})
+	}
+
+	// Respond with the sessions
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// RevokeSessionHandler revokes one session of the authenticated user
+func (app *application) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Revoking session...")
+
+	// Extract session ID from the request
+	params := mux.Vars(r)
+	sessionID, err := strconv.ParseInt(params["sessionID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	p := principalFrom(r)
+	if err := app.store.RevokeSession(p.UserID, sessionID, time.Now()); err != nil {
+		if errors.Is(err, data.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to revoke session:", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	app.revocations.forget(sessionID)
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Session revoked successfully",
+		"sessionID": sessionID,
+	})
+}
+
+// RevokeOtherSessionsHandler logs the authenticated user out everywhere
+// except the session the request was made from
+func (app *application) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Revoking other sessions...")
+
+	p := principalFrom(r)
+	revoked, err := app.store.RevokeOtherSessions(p.UserID, p.SessionID, time.Now())
+	if err != nil {
+		log.Println("Failed to revoke sessions:", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	app.revocations.forgetUser(p.UserID)
+
+	// Respond with the number of sessions revoked
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Other sessions revoked successfully",
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,147 @@
+// session_handlers_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      int
+	}{
+		{"short", "curl/8.0", 8},
+		{"ASCII", strings.Repeat("a", 300), maxUserAgentLength},
+		{"two-byte characters", strings.Repeat("é", 200), maxUserAgentLength - 1},
+		{"three-byte characters", strings.Repeat("€", 100), maxUserAgentLength},
+		{"four-byte character across the limit", strings.Repeat("a", 253) + "😀", 253},
+	}
+	for _, tt := range tests {
+		got := truncateUserAgent(tt.userAgent)
+		if len(got) != tt.want || !utf8.ValidString(got) || !strings.HasPrefix(tt.userAgent, got) {
+			t.Errorf("%s: truncated to %d bytes (valid UTF-8: %v), want %d", tt.name, len(got), utf8.ValidString(got), tt.want)
+		}
+	}
+}
+
+// loginFrom logs a user in with the given user agent and returns their access token
+func loginFrom(t *testing.T, app *application, email, userAgent string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"email": %q, "password": "secret"}`, email)))
+	r.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	return decode(t, w)["accessToken"].(string)
+}
+
+// listSessions returns the sessions of the holder of token
+func listSessions(t *testing.T, app *application, token string) []sessionView {
+	t.Helper()
+	w := request(t, app, http.MethodGet, "/sessions", nil, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list sessions: status %d: %s", w.Code, w.Body.String())
+	}
+	var sessions []sessionView
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("decoding sessions: %v", err)
+	}
+	return sessions
+}
+
+func TestSessionHandlers(t *testing.T) {
+	app, _ := newTestApp(t)
+	registerUser(t, app, "user@example.com", "secret")
+	registerUser(t, app, "other@example.com", "secret")
+	phoneToken := loginFrom(t, app, "user@example.com", "Phone")
+	laptopToken := loginFrom(t, app, "user@example.com", "Laptop")
+	otherToken := loginFrom(t, app, "other@example.com", "Other")
+
+	// Each login has its own session, and logging in again kept the first one
+	sessions := listSessions(t, app, phoneToken)
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions, want 2", len(sessions))
+	}
+	var phoneID, laptopID int64
+	for _, session := range sessions {
+		switch session.UserAgent {
+		case "Phone":
+			phoneID = session.ID
+			if !session.Current {
+				t.Error("the session of the request is not marked current")
+			}
+		case "Laptop":
+			laptopID = session.ID
+			if session.Current {
+				t.Error("another session is marked current")
+			}
+		}
+	}
+	if phoneID == 0 || laptopID == 0 {
+		t.Fatalf("sessions = %+v, want the phone and the laptop", sessions)
+	}
+
+	// Sessions of other users cannot be revoked
+	if w := request(t, app, http.MethodDelete, fmt.Sprintf("/sessions/%d", laptopID), nil, otherToken); w.Code != http.StatusNotFound {
+		t.Errorf("another user's session: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, laptopToken); w.Code != http.StatusOK {
+		t.Errorf("laptop after another user tried to revoke it: status %d", w.Code)
+	}
+
+	if w := request(t, app, http.MethodDelete, fmt.Sprintf("/sessions/%d", laptopID), nil, phoneToken); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, laptopToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(t, app, http.MethodDelete, fmt.Sprintf("/sessions/%d", laptopID), nil, phoneToken); w.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(t, app, http.MethodDelete, "/sessions/abc", nil, phoneToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid session ID: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if sessions := listSessions(t, app, phoneToken); len(sessions) != 1 || sessions[0].ID != phoneID {
+		t.Errorf("sessions after the revocation = %+v, want only the phone", sessions)
+	}
+
+	// Logging out everywhere else keeps the current session only
+	tabletToken := loginFrom(t, app, "user@example.com", "Tablet")
+	desktopToken := loginFrom(t, app, "user@example.com", "Desktop")
+	w := request(t, app, http.MethodPost, "/sessions/revoke-others", nil, phoneToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke others: status %d: %s", w.Code, w.Body.String())
+	}
+	if revoked := decode(t, w)["revoked"]; revoked != float64(2) {
+		t.Errorf("%v sessions revoked, want 2", revoked)
+	}
+	for _, token := range []string{tabletToken, desktopToken} {
+		if w := request(t, app, http.MethodGet, "/profile", nil, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("session revoked by revoke-others: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, phoneToken); w.Code != http.StatusOK {
+		t.Errorf("current session after revoke-others: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, otherToken); w.Code != http.StatusOK {
+		t.Errorf("another user's session after revoke-others: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Logging out only ends the current session
+	if w := request(t, app, http.MethodPost, "/logout", nil, phoneToken); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, phoneToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("session after logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
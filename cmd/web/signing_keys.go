@@ -0,0 +1,244 @@
+// signing_keys.go
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// defaultKeyGracePeriod is how long a signing key keeps verifying tokens
+// after the next key has taken over. It outlasts the access token lifetime.
+const defaultKeyGracePeriod = time.Hour
+
+// minRSAKeyBits is the smallest RSA signing key accepted
+const minRSAKeyBits = 2048
+
+// signingKey is a key tokens are signed and verified with
+type signingKey struct {
+	id         string            // Key ID sent in the kid header; empty for the HS256 secret
+	method     jwt.SigningMethod // Algorithm the key signs with
+	signKey    interface{}       // Secret or private key
+	verifyKey  interface{}       // Secret or public key
+	activeFrom time.Time         // Time from which the key signs new tokens; zero for immediately
+}
+
+// keyRing holds the keys of one kind of token. The newest active key signs
+// new tokens; the key it replaced keeps verifying tokens for the grace period.
+type keyRing struct {
+	keys  []*signingKey // sorted by activeFrom
+	grace time.Duration
+}
+
+// hmacKeyRing returns a key ring with the HS256 secret read from the named
+// environment variable
+func hmacKeyRing(name string) (*keyRing, error) {
+	secret := os.Getenv(name)
+	if secret == "" {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+
+	return &keyRing{keys: []*signingKey{{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}}}, nil
+}
+
+// loadSigningKeys reads the token signing keys from the environment. Access
+// tokens are signed with the private keys listed in JWT_SIGNING_KEYS, or with
+// the HS256 secret JWT_ACCESS_KEY when it is not set. Refresh tokens are only
+// read by this service and are always signed with JWT_REFRESH_KEY.
+func loadSigningKeys() (*keyRing, *keyRing, error) {
+	refreshKeys, err := hmacKeyRing("JWT_REFRESH_KEY")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value := os.Getenv("JWT_SIGNING_KEYS")
+	if value == "" {
+		accessKeys, err := hmacKeyRing("JWT_ACCESS_KEY")
+		if err != nil {
+			return nil, nil, err
+		}
+		return accessKeys, refreshKeys, nil
+	}
+
+	accessKeys := &keyRing{grace: defaultKeyGracePeriod}
+	if grace := os.Getenv("JWT_KEY_GRACE_PERIOD"); grace != "" {
+		if accessKeys.grace, err = time.ParseDuration(grace); err != nil {
+			return nil, nil, fmt.Errorf("invalid JWT_KEY_GRACE_PERIOD: %w", err)
+		}
+	}
+
+	// Each entry is kid=path, optionally followed by @ and the RFC 3339 time
+	// from which the key signs new tokens
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, nil, fmt.Errorf("invalid JWT_SIGNING_KEYS entry %q (expected kid=path[@time])", entry)
+		}
+		if seen[kid] {
+			return nil, nil, fmt.Errorf("duplicate key ID %q in JWT_SIGNING_KEYS", kid)
+		}
+		seen[kid] = true
+
+		file, from, scheduled := strings.Cut(path, "@")
+		var activeFrom time.Time
+		if scheduled {
+			if activeFrom, err = time.Parse(time.RFC3339, from); err != nil {
+				return nil, nil, fmt.Errorf("invalid activation time for key %q: %w", kid, err)
+			}
+		}
+
+		key, err := readPrivateKey(kid, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.activeFrom = activeFrom
+		accessKeys.keys = append(accessKeys.keys, key)
+	}
+	sort.SliceStable(accessKeys.keys, func(i, j int) bool {
+		return accessKeys.keys[i].activeFrom.Before(accessKeys.keys[j].activeFrom)
+	})
+
+	return accessKeys, refreshKeys, nil
+}
+
+// readPrivateKey reads an RSA or Ed25519 private key from a PEM file
+func readPrivateKey(kid, path string) (*signingKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %q: %w", kid, err)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("key %q is not PEM encoded", kid)
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q has unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key %q: %w", kid, err)
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key %q is shorter than %d bits", kid, minRSAKeyBits)
+		}
+		return &signingKey{id: kid, method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{id: kid, method: signingMethodEdDSA, signKey: private, verifyKey: private.Public()}, nil
+	default:
+		return nil, fmt.Errorf("key %q is neither an RSA nor an Ed25519 key", kid)
+	}
+}
+
+// current returns the key that signs new tokens at the given time
+func (k *keyRing) current(now time.Time) (*signingKey, error) {
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].activeFrom.After(now) {
+			return k.keys[i], nil
+		}
+	}
+	return nil, errors.New("no signing key is active yet")
+}
+
+// retired reports whether the key at index i no longer verifies tokens,
+// because the key after it took over more than the grace period ago
+func (k *keyRing) retired(i int, now time.Time) bool {
+	if i+1 >= len(k.keys) || k.keys[i+1].activeFrom.After(now) {
+		return false
+	}
+	return !now.Before(k.keys[i+1].activeFrom.Add(k.grace))
+}
+
+// verifier returns the key with the given ID if it verifies tokens at the given time
+func (k *keyRing) verifier(kid string, now time.Time) (*signingKey, bool) {
+	for i, key := range k.keys {
+		if key.id != kid {
+			continue
+		}
+		if key.activeFrom.After(now) || k.retired(i, now) {
+			return nil, false
+		}
+		return key, true
+	}
+	return nil, false
+}
+
+// published returns the public keys other services may verify tokens with
+// at the given time. Scheduled keys are included before they take over, so
+// that verifiers can fetch them in advance.
+func (k *keyRing) published(now time.Time) []*signingKey {
+	var keys []*signingKey
+	for i, key := range k.keys {
+		if key.method == jwt.SigningMethodHS256 || k.retired(i, now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// edDSASigningMethod implements the EdDSA JWT algorithm with Ed25519 keys,
+// which jwt-go does not provide
+type edDSASigningMethod struct{}
+
+// signingMethodEdDSA signs tokens with Ed25519 keys
+var signingMethodEdDSA = &edDSASigningMethod{}
+
+func init() {
+	jwt.RegisterSigningMethod(signingMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return signingMethodEdDSA
+	})
+}
+
+// Alg returns the name of the algorithm in the alg header
+func (m *edDSASigningMethod) Alg() string {
+	return "EdDSA"
+}
+
+// Sign signs signingString with an ed25519.PrivateKey
+func (m *edDSASigningMethod) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+// Verify checks the signature of signingString with an ed25519.PublicKey
+func (m *edDSASigningMethod) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// store.go
+
+package main
+
+import (
+	"backend-project/data"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// defaultSQLitePath is the database file used when DB_PATH is not set
+const defaultSQLitePath = "tickets.db"
+
+// openStore opens the storage backend named by driver
+func openStore(driver string) (data.Store, error) {
+	switch driver {
+	case "", "mysql":
+		return openMySQLStore()
+	case "postgres":
+		return openPostgresStore()
+	case "sqlite":
+		return openSQLiteStore(os.Getenv("DB_PATH"))
+	case "memory":
+		// Demo mode needs no external services, so make sure tokens can still be signed
+		if err := ensureSigningKeys(); err != nil {
+			return nil, err
+		}
+		log.Println("Using the in-memory store, all data will be lost when the server stops.")
+		return data.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
+
+// openMySQLStore connects to the MySQL database described by the DB_* environment variables
+func openMySQLStore() (data.Store, error) {
+	// Database connection details
+	dbUser := os.Getenv("DB_USER")
+	dbPassword := os.Getenv("DB_PASSWORD")
+	dbHost := os.Getenv("DB_HOST")
+	dbPort := os.Getenv("DB_PORT")
+	dbName := os.Getenv("DB_DATABASE")
+
+	// Construct data source name; clientFoundRows makes updates report the
+	// rows they matched rather than the rows they changed
+	dataSourceName := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true", dbUser, dbPassword, dbHost, dbPort, dbName)
+
+	// Print the connection target for debugging, without the password
+	log.Printf("Connecting to MySQL at %s:%s/%s as %s", dbHost, dbPort, dbName, dbUser)
+
+	// Initialize database connection
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	// Check if the database connection is successful
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("error pinging the database: %w", err)
+	}
+	log.Println("Connected to the database.")
+
+	return data.NewMySQLStore(db), nil
+}
+
+// openPostgresStore connects to the PostgreSQL database described by the DB_* environment variables
+func openPostgresStore() (data.Store, error) {
+	// Database connection details, DB_SSLMODE defaults to the driver's "prefer"
+	dbUser := os.Getenv("DB_USER")
+	dbPassword := os.Getenv("DB_PASSWORD")
+	dbHost := os.Getenv("DB_HOST")
+	dbPort := os.Getenv("DB_PORT")
+	dbName := os.Getenv("DB_DATABASE")
+
+	dataSourceName := (&url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(dbUser, dbPassword),
+		Host:   dbHost + ":" + dbPort,
+		Path:   dbName,
+	}).String()
+	if sslMode := os.Getenv("DB_SSLMODE"); sslMode != "" {
+		dataSourceName += "?sslmode=" + url.QueryEscape(sslMode)
+	}
+
+	log.Printf("Connecting to PostgreSQL at %s:%s/%s as %s", dbHost, dbPort, dbName, dbUser)
+
+	db, err := sql.Open("pgx", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	// Check if the database connection is successful
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("error pinging the database: %w", err)
+	}
+	log.Println("Connected to the database.")
+
+	return data.NewPostgresStore(db), nil
+}
+
+// openSQLiteStore opens (or creates) the SQLite database file at path
+func openSQLiteStore(path string) (data.Store, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+
+	// Wait on locks instead of failing immediately, and use WAL so reads do not block writes
+	dataSourceName := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+
+	db, err := sql.Open("sqlite", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the sqlite database: %w", err)
+	}
+
+	log.Printf("Using the SQLite database at %s", path)
+
+	return data.NewSQLiteStore(db), nil
+}
@@ -0,0 +1,110 @@
+// store_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores returns an in-memory store and a migrated SQLite store, so store
+// behaviour can be checked against both backends
+func testStores(t *testing.T) map[string]data.Store {
+	t.Helper()
+	sqliteStore, err := openSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening the sqlite store: %v", err)
+	}
+	sqlStore := sqliteStore.(*data.SQLStore)
+	t.Cleanup(func() { sqlStore.DB().Close() })
+	if _, err := sqlStore.MigrateUp(); err != nil {
+		t.Fatalf("migrating the sqlite store: %v", err)
+	}
+
+	return map[string]data.Store{
+		"memory": data.NewMemoryStore(),
+		"sqlite": sqlStore,
+	}
+}
+
+// createTestUser adds an active user with the given role straight to a store
+func createTestUser(t *testing.T, store data.Store, email, role string) int {
+	t.Helper()
+	userID, err := store.CreateUser(&data.User{Email: email, Password: "x", UserActive: 1, Role: role})
+	if err != nil {
+		t.Fatalf("CreateUser %s: %v", email, err)
+	}
+	return userID
+}
+
+func TestUpdateTicketPriority(t *testing.T) {
+	for name, store := range testStores(t) {
+		userID := createTestUser(t, store, "customer@example.com", data.RoleCustomer)
+		ticketID, err := store.CreateTicket(userID, "Subject", "Issue", data.TicketPriorityNormal)
+		if err != nil {
+			t.Fatalf("%s: CreateTicket: %v", name, err)
+		}
+
+		// Setting the values a ticket already has is not a missing ticket
+		for i := 0; i < 2; i++ {
+			if err := store.UpdateTicketPriority(int64(ticketID), data.TicketPriorityHigh, data.TicketSeverityMajor); err != nil {
+				t.Errorf("%s: update %d: %v", name, i+1, err)
+			}
+		}
+		ticket, err := store.GetTicketByID(int64(ticketID))
+		if err != nil {
+			t.Fatalf("%s: GetTicketByID: %v", name, err)
+		}
+		if ticket.Priority != data.TicketPriorityHigh || ticket.Severity == nil || *ticket.Severity != data.TicketSeverityMajor {
+			t.Errorf("%s: priority = %q, severity = %v", name, ticket.Priority, ticket.Severity)
+		}
+
+		if err := store.UpdateTicketPriority(int64(ticketID)+100, data.TicketPriorityHigh, ""); !errors.Is(err, data.ErrTicketNotFound) {
+			t.Errorf("%s: unknown ticket: error = %v, want %v", name, err, data.ErrTicketNotFound)
+		}
+	}
+}
+
+func TestRecordLoginFailureConcurrently(t *testing.T) {
+	const failures = 50
+
+	for name, store := range testStores(t) {
+		// Every failure is counted, including concurrent first ones for an address
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		errs := make(chan error, failures)
+		for i := 0; i < failures; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, err := store.RecordLoginFailure("user@example.com", time.Now()); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("%s: RecordLoginFailure: %v", name, err)
+		}
+
+		recorded, err := store.GetLoginFailures("USER@example.com")
+		if err != nil {
+			t.Fatalf("%s: GetLoginFailures: %v", name, err)
+		}
+		if recorded.FailedAttempts != failures || recorded.LastFailedAt == nil {
+			t.Errorf("%s: %d failed attempts recorded, want %d", name, recorded.FailedAttempts, failures)
+		}
+
+		attempts, err := store.RecordLoginFailure("user@example.com", time.Now())
+		if err != nil || attempts != failures+1 {
+			t.Errorf("%s: next failure: attempts = %d, %v, want %d", name, attempts, err, failures+1)
+		}
+	}
+}
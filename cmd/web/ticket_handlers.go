@@ -4,11 +4,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"backend-project/data"
 
@@ -16,111 +16,74 @@ import (
 )
 
 // CreateTicketHandler handles requests to create a new ticket.
-func CreateTicketHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) CreateTicketHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Creating ticket...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
-	}
-
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract the user ID associated with the access token
-	userID, err := data.GetUserIDByAccessToken(accessToken)
-	if err != nil {
-		log.Println("Failed to extract user ID:", err)
-		http.Error(w, "Failed to extract user ID", http.StatusInternalServerError)
-		return
-	}
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
 
 	// Parse request body
 	var ticketData struct {
-		Subject string `json:"subject"`
-		Issue   string `json:"issue"`
+		Subject  string `json:"subject"`
+		Issue    string `json:"issue"`
+		Priority string `json:"priority"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&ticketData); err != nil {
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
+	// Tickets are normal priority unless the customer asks otherwise
+	if ticketData.Priority == "" {
+		ticketData.Priority = data.TicketPriorityNormal
+	}
+	if !data.ValidTicketPriority(ticketData.Priority) {
+		http.Error(w, fmt.Sprintf("Invalid ticket priority %q", ticketData.Priority), http.StatusBadRequest)
+		return
+	}
+
 	// Create ticket
-	ticketID, err := data.CreateTicket(userID, ticketData.Subject, ticketData.Issue)
+	ticketID, err := app.store.CreateTicket(userID, ticketData.Subject, ticketData.Issue, ticketData.Priority)
 	if err != nil {
 		log.Println("Error creating ticket:", err)
 		http.Error(w, "Failed to create ticket", http.StatusInternalServerError)
 		return
 	}
 
+	// Hand the ticket to an operator if automatic assignment is turned on
+	app.autoAssignTicket(int64(ticketID))
+
 	// Respond with ticket ID
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(struct{ TicketID int }{TicketID: ticketID})
 }
 
 // AddConversationHandler handles requests to add a conversation to a ticket.
-func AddConversationHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) AddConversationHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Adding conversation...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
-	}
-
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
-		return
-	}
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
 
-	// Extract the user's email from the access token
-	email, err := data.GetUserEmailByAccessToken(accessToken)
-	if err != nil {
-		log.Println("Error retrieving user email from access token:", err)
-		http.Error(w, "Error retrieving user email", http.StatusInternalServerError)
-		return
-	}
-
-	// Retrieve the user's first name from the database using the email
-	user, err := data.GetUserByEmail(email)
+	// Retrieve the user's first name from the database
+	user, err := app.store.GetUserByID(userID)
 	if err != nil {
 		log.Println("Error retrieving user profile:", err)
 		http.Error(w, "Error retrieving user profile", http.StatusInternalServerError)
 		return
 	}
 
-	if user == nil {
-		log.Println("User profile not found")
-		http.Error(w, "User profile not found", http.StatusNotFound)
+	// Look up the ticket, which must belong to the authenticated user
+	ticket, ok := app.userTicket(w, r, userID)
+	if !ok {
 		return
 	}
 
-	// Extract the ticket ID from the request URL parameters
-	params := mux.Vars(r)
-	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+	// Customers cannot reply to a closed ticket until it is reopened
+	if ticket.Status == data.TicketStatusClosed {
+		http.Error(w, "Ticket is closed. Reopen it to send a message", http.StatusConflict)
 		return
 	}
 
@@ -134,7 +97,7 @@ func AddConversationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the conversation to the database with the user's first name as the sender
-	_, err = data.AddConversation(ticketID, user.FirstName, conversation.Message)
+	_, err = app.store.AddConversation(ticket.ID, int64(user.ID), user.FirstName, conversation.Message)
 	if err != nil {
 		log.Println("Failed to add conversation to ticket:", err)
 		http.Error(w, "Failed to add conversation to ticket", http.StatusInternalServerError)
@@ -146,40 +109,16 @@ func AddConversationHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Message successfully sent")
 }
 
-// GetTicketsHandler retrieves tickets for the user associated with the access token.
-func GetTicketsHandler(w http.ResponseWriter, r *http.Request) {
+// GetTicketsHandler retrieves tickets for the authenticated user.
+func (app *application) GetTicketsHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Getting all tickets...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
-	}
-
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
-		return
-	}
-
-	// Get user ID as int64
-	userID, err := data.GetUserIDByAccessTokenInt64(accessToken)
-	if err != nil {
-		log.Printf("Failed to retrieve user ID: %v", err)
-		http.Error(w, "Failed to retrieve user ID", http.StatusInternalServerError)
-		return
-	}
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
 
 	// Get tickets for user
-	tickets, err := data.GetTicketsByUserID(userID)
+	tickets, err := app.store.GetTicketsByUserID(int64(userID))
 	if err != nil {
 		log.Printf("Failed to retrieve tickets: %v", err)
 		http.Error(w, "Failed to retrieve tickets", http.StatusInternalServerError)
@@ -192,59 +131,21 @@ func GetTicketsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetTicketByIDHandler handles requests to retrieve a specific ticket by its ID along with its conversations.
-func GetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) GetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Getting ticket by ID...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
-	}
-
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract userID from the access token
-	userID, err := data.GetUserIDByAccessTokenInt64(accessToken)
-	if err != nil {
-		http.Error(w, "Failed to retrieve user ID from access token", http.StatusInternalServerError)
-		return
-	}
-
-	// Extract ticketID from request URL
-	params := mux.Vars(r)
-	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
-		return
-	}
-
-	// Get ticket details by ID
-	ticket, err := data.GetTicketByID(ticketID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
-		return
-	}
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
 
-	// Check if the ticket belongs to the authenticated user
-	if ticket.UserID != userID {
-		http.Error(w, "No ticket associated with this ID", http.StatusForbidden)
+	// Look up the ticket, which must belong to the authenticated user
+	ticket, ok := app.userTicket(w, r, userID)
+	if !ok {
 		return
 	}
 
 	// Get conversations for the ticket
-	conversations, err := data.GetConversationsByTicketID(ticketID)
+	conversations, err := app.store.GetConversationsByTicketID(ticket.ID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve conversations", http.StatusInternalServerError)
 		return
@@ -268,72 +169,144 @@ func GetTicketByIDHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // CloseTicketHandler handles requests to close a ticket.
-func CloseTicketHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) CloseTicketHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Closing ticket...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
+
+	// Look up the ticket, which must belong to the authenticated user
+	ticket, ok := app.userTicket(w, r, userID)
+	if !ok {
 		return
 	}
 
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
+	// Mark the ticket as closed, keeping its conversation history
+	if !app.changeTicketStatus(w, ticket, data.TicketStatusClosed, int64(userID), false) {
+		return
 	}
 
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
+	// Respond with success message
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Ticket %d closed successfully", ticket.ID)
+}
+
+// ReopenTicketHandler handles requests to reopen a resolved or closed ticket.
+func (app *application) ReopenTicketHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Reopening ticket...")
+
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
+
+	// Look up the ticket, which must belong to the authenticated user
+	ticket, ok := app.userTicket(w, r, userID)
+	if !ok {
 		return
 	}
 
-	// Extract userID from the access token
-	userID, err := data.GetUserIDByAccessTokenInt64(accessToken)
-	if err != nil {
-		http.Error(w, "Failed to retrieve user ID from access token", http.StatusInternalServerError)
+	if !app.changeTicketStatus(w, ticket, data.TicketStatusReopened, int64(userID), false) {
 		return
 	}
 
-	// Extract ticketID from the request URL
-	params := mux.Vars(r)
-	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+	// Respond with success message
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Ticket %d reopened successfully", ticket.ID)
+}
+
+// UpdateTicketStatusHandler handles requests from a customer to change the status of their ticket.
+func (app *application) UpdateTicketStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Updating ticket status...")
+
+	// The user was authenticated from the access token by the middleware
+	userID := principalFrom(r).UserID
+
+	// Look up the ticket, which must belong to the authenticated user
+	ticket, ok := app.userTicket(w, r, userID)
+	if !ok {
 		return
 	}
 
-	// Check if the ticket belongs to the authenticated user
-	if !isTicketOwnedByUser(ticketID, userID) {
-		http.Error(w, "No ticket associated with this ID", http.StatusForbidden)
+	// Parse the request body to get the new status
+	var request struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
-	// Delete ticket and associated conversations from the database
-	if err := data.CloseTicket(ticketID); err != nil {
-		log.Printf("Failed to close ticket: %v", err)
-		http.Error(w, "Failed to close ticket", http.StatusInternalServerError)
+	if !app.changeTicketStatus(w, ticket, request.Status, int64(userID), false) {
 		return
 	}
 
-	// Respond with success message
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Ticket %d closed successfully", ticketID)
+	// Respond with the new status
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticketID": ticket.ID,
+		"status":   request.Status,
+	})
 }
 
-// isTicketOwnedByUser checks if the ticket with the given ID belongs to the specified user.
-func isTicketOwnedByUser(ticketID int64, userID int64) bool {
-	// Retrieve the user ID associated with the ticket
-	ticketUserID, err := data.GetUserIDByTicketID(ticketID)
-	if err != nil {
-		// Handle the error (e.g., log it) and return false
-		log.Println("Error retrieving user ID for ticket:", err)
+// changeTicketStatus moves a ticket to a new status if the lifecycle allows it.
+// On failure it writes the error response and returns false.
+func (app *application) changeTicketStatus(w http.ResponseWriter, ticket data.Ticket, status string, userID int64, operator bool) bool {
+	if ticket.Status == status {
+		http.Error(w, fmt.Sprintf("Ticket is already %s", status), http.StatusConflict)
 		return false
 	}
 
-	// Compare the retrieved user ID with the specified userID
-	return ticketUserID == userID
+	err := data.CheckTicketTransition(ticket.Status, status, operator)
+	if err == nil {
+		err = app.store.UpdateTicketStatus(ticket.ID, ticket.Status, status, userID)
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, data.ErrInvalidTicketStatus):
+		http.Error(w, fmt.Sprintf("Invalid ticket status %q", status), http.StatusBadRequest)
+	case errors.Is(err, data.ErrTicketTransitionNotAllowed):
+		http.Error(w, fmt.Sprintf("Cannot change ticket status from %s to %s", ticket.Status, status), http.StatusConflict)
+	case errors.Is(err, data.ErrTicketStatusChanged):
+		http.Error(w, "Ticket status was changed by someone else, please try again", http.StatusConflict)
+	case errors.Is(err, data.ErrTicketNotFound):
+		http.Error(w, "No ticket associated with this ID", http.StatusNotFound)
+	default:
+		log.Printf("Failed to update ticket status: %v", err)
+		http.Error(w, "Failed to update ticket status", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// userTicket looks up the ticket named in the request URL. Tickets that do
+// not exist or belong to another user are reported the same way, so that
+// ticket IDs cannot be probed. On failure it writes the error response and
+// returns false.
+func (app *application) userTicket(w http.ResponseWriter, r *http.Request, userID int) (data.Ticket, bool) {
+	// Extract ticketID from the request URL
+	params := mux.Vars(r)
+	ticketID, err := strconv.ParseInt(params["ticketID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return data.Ticket{}, false
+	}
+
+	// Get ticket details by ID
+	ticket, err := app.store.GetTicketByID(ticketID)
+	if err != nil && !errors.Is(err, data.ErrTicketNotFound) {
+		log.Printf("Failed to retrieve ticket: %v", err)
+		http.Error(w, "Failed to retrieve ticket", http.StatusInternalServerError)
+		return data.Ticket{}, false
+	}
+
+	// Check if the ticket belongs to the authenticated user
+	if err != nil || ticket.UserID != int64(userID) {
+		http.Error(w, "No ticket associated with this ID", http.StatusForbidden)
+		return data.Ticket{}, false
+	}
+
+	return ticket, true
 }
@@ -0,0 +1,120 @@
+// ticket_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCheckTicketTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		operator bool
+		want     error
+	}{
+		{data.TicketStatusNew, data.TicketStatusResolved, false, nil},
+		{data.TicketStatusOnHold, data.TicketStatusClosed, false, nil},
+		{data.TicketStatusResolved, data.TicketStatusClosed, false, nil},
+		{data.TicketStatusResolved, data.TicketStatusReopened, false, nil},
+		{data.TicketStatusClosed, data.TicketStatusReopened, false, nil},
+		{data.TicketStatusNew, data.TicketStatusOpen, false, data.ErrTicketTransitionNotAllowed},
+		{data.TicketStatusOpen, data.TicketStatusPendingAgent, false, data.ErrTicketTransitionNotAllowed},
+		{data.TicketStatusOpen, data.TicketStatusReopened, false, data.ErrTicketTransitionNotAllowed},
+		{data.TicketStatusClosed, data.TicketStatusResolved, false, data.ErrTicketTransitionNotAllowed},
+		{data.TicketStatusResolved, data.TicketStatusNew, false, data.ErrTicketTransitionNotAllowed},
+		{data.TicketStatusClosed, data.TicketStatusNew, true, nil},
+		{data.TicketStatusResolved, data.TicketStatusPendingCustomer, true, nil},
+		{data.TicketStatusOpen, "waiting", true, data.ErrInvalidTicketStatus},
+		{data.TicketStatusOpen, "waiting", false, data.ErrInvalidTicketStatus},
+	}
+	for _, tt := range tests {
+		if err := data.CheckTicketTransition(tt.from, tt.to, tt.operator); !errors.Is(err, tt.want) {
+			t.Errorf("%s to %s (operator %v): error = %v, want %v", tt.from, tt.to, tt.operator, err, tt.want)
+		}
+	}
+}
+
+func TestCustomerTicketStatusChanges(t *testing.T) {
+	app, store := newTestApp(t)
+	registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	registerUser(t, app, "other@example.com", "secret")
+	otherToken, _ := login(t, app, "other@example.com", "secret")
+	ticketID := createTicket(t, app, customerToken)
+	path := fmt.Sprintf("/tickets/%d", ticketID)
+
+	// Each step is taken in turn on the same ticket
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		status string
+		token  string
+		code   int
+		want   string
+	}{
+		{"customers cannot work on their ticket", http.MethodPatch, "/status", data.TicketStatusOpen, customerToken, http.StatusConflict, data.TicketStatusNew},
+		{"customers cannot reopen an unresolved ticket", http.MethodPost, "/reopen", "", customerToken, http.StatusConflict, data.TicketStatusNew},
+		{"invalid status", http.MethodPatch, "/status", "waiting", customerToken, http.StatusBadRequest, data.TicketStatusNew},
+		{"other customers cannot change the ticket", http.MethodPatch, "/status", data.TicketStatusResolved, otherToken, http.StatusForbidden, data.TicketStatusNew},
+		{"resolve", http.MethodPatch, "/status", data.TicketStatusResolved, customerToken, http.StatusOK, data.TicketStatusResolved},
+		{"resolving twice", http.MethodPatch, "/status", data.TicketStatusResolved, customerToken, http.StatusConflict, data.TicketStatusResolved},
+		{"customers cannot move a resolved ticket back", http.MethodPatch, "/status", data.TicketStatusPendingAgent, customerToken, http.StatusConflict, data.TicketStatusResolved},
+		{"close", http.MethodDelete, "", "", customerToken, http.StatusOK, data.TicketStatusClosed},
+		{"customers cannot resolve a closed ticket", http.MethodPatch, "/status", data.TicketStatusResolved, customerToken, http.StatusConflict, data.TicketStatusClosed},
+		{"reopen", http.MethodPost, "/reopen", "", customerToken, http.StatusOK, data.TicketStatusReopened},
+	}
+	for _, step := range steps {
+		var body interface{}
+		if step.status != "" {
+			body = map[string]string{"status": step.status}
+		}
+		if w := request(t, app, step.method, path+step.path, body, step.token); w.Code != step.code {
+			t.Errorf("%s: status %d, want %d: %s", step.name, w.Code, step.code, w.Body.String())
+		}
+		ticket, err := store.GetTicketByID(ticketID)
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if ticket.Status != step.want {
+			t.Errorf("%s: ticket is %s, want %s", step.name, ticket.Status, step.want)
+		}
+	}
+}
+
+func TestOperatorTicketStatusChanges(t *testing.T) {
+	app, store := newTestApp(t)
+	_, agentToken := registerStaff(t, app, "agent@example.com", data.RoleAgent)
+	registerUser(t, app, "customer@example.com", "secret")
+	customerToken, _ := login(t, app, "customer@example.com", "secret")
+	ticketID := createTicket(t, app, customerToken)
+	path := fmt.Sprintf("/admin/tickets/%d/status", ticketID)
+
+	// Operators may move a ticket to any status, including back to new
+	for _, status := range []string{data.TicketStatusClosed, data.TicketStatusPendingCustomer, data.TicketStatusNew} {
+		if w := request(t, app, http.MethodPatch, path, map[string]string{"status": status}, agentToken); w.Code != http.StatusOK {
+			t.Errorf("to %s: status %d: %s", status, w.Code, w.Body.String())
+		}
+		ticket, err := store.GetTicketByID(ticketID)
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if ticket.Status != status {
+			t.Errorf("ticket is %s, want %s", ticket.Status, status)
+		}
+	}
+
+	if w := request(t, app, http.MethodPatch, path, map[string]string{"status": data.TicketStatusNew}, agentToken); w.Code != http.StatusConflict {
+		t.Errorf("same status: status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := request(t, app, http.MethodPatch, path, map[string]string{"status": "waiting"}, agentToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid status: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := request(t, app, http.MethodPatch, "/admin/tickets/999/status", map[string]string{"status": data.TicketStatusOpen}, agentToken); w.Code != http.StatusNotFound {
+		t.Errorf("unknown ticket: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -4,28 +4,130 @@ package main
 
 import (
 	"backend-project/data"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+// Token lifetimes. A session lasts as long as its refresh token.
+const (
+	accessTokenLifetime    = 30 * time.Minute
+	refreshTokenLifetime   = 30 * 24 * time.Hour
+	twoFactorTokenLifetime = 5 * time.Minute
+	// impersonationTokenLifetime is kept short, as there is no refresh token
+	// to renew an impersonation
+	impersonationTokenLifetime = 15 * time.Minute
+)
+
+// Token types carried in the token_type claim
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+	// tokenTypeTwoFactor is returned by a login that still needs a second
+	// factor; it is only accepted by /login/2fa
+	tokenTypeTwoFactor = "two-factor"
+)
+
+// Authentication methods carried in the amr claim (RFC 8176)
+const (
+	authMethodPassword = "pwd"
+	authMethodOTP      = "otp"
+)
+
+// tokenActor names who acts on behalf of the subject of a token (the act
+// claim of RFC 8693)
+type tokenActor struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
+
+// tokenClaims are the claims of the access and refresh tokens. Besides the
+// subject they carry what other services need to authorise a request
+// without calling back to this one.
+type tokenClaims struct {
+	Email     string   `json:"email,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Admin     bool     `json:"admin"`
+	SessionID int64    `json:"sid,omitempty"`
+	TokenType string   `json:"token_type"`
+	AMR       []string `json:"amr,omitempty"`
+
+	// Impersonation tokens name the administrator in act, and are read-only
+	// unless the administrator asked otherwise
+	Actor    *tokenActor `json:"act,omitempty"`
+	ReadOnly bool        `json:"read_only,omitempty"`
+
+	jwt.StandardClaims
+}
+
+// twoFactor reports whether the login the token was issued for used a second factor
+func (c *tokenClaims) twoFactor() bool {
+	for _, method := range c.AMR {
+		if method == authMethodOTP {
+			return true
+		}
+	}
+	return false
+}
+
+// userID returns the user ID stored in the token subject
+func (c *tokenClaims) userID() (int, error) {
+	userID, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0, errors.New("invalid user ID in token")
+	}
+	return userID, nil
+}
+
+// actorID returns the user ID of the administrator impersonating the
+// subject, or zero when the token is not an impersonation token
+func (c *tokenClaims) actorID() (int, error) {
+	if c.Actor == nil {
+		return 0, nil
+	}
+	actorID, err := strconv.Atoi(c.Actor.Subject)
+	if err != nil || actorID <= 0 {
+		return 0, errors.New("invalid actor in token")
+	}
+	return actorID, nil
+}
+
+// userRole returns the role of a user as stored in the tokens
+func userRole(user *data.User) string {
+	if user.Role == "" {
+		return data.RoleCustomer
+	}
+	return user.Role
+}
+
+// newTokenID returns a random 128-bit ID, hex encoded, for refresh and reset tokens
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
 // generateTokens generates access and refresh tokens for the given user
-func generateTokens(user *data.User) (string, string, error) {
+// session. The refresh token gets the current refresh token ID of the
+// session as its ID (jti claim).
+func (app *application) generateTokens(user *data.User, session *data.Session) (string, string, error) {
 	// Generate access token with 30 minutes expiry
-	accessToken, err := generateAuthJWT(user, os.Getenv("JWT_ACCESS_KEY"), 30*time.Minute)
+	accessToken, err := app.generateAuthJWT(user, tokenTypeAccess, session, "")
 	if err != nil {
 		return "", "", err
 	}
 
 	// Generate refresh token with 30 days expiry
-	refreshToken, err := generateAuthJWT(user, os.Getenv("JWT_REFRESH_KEY"), 30*24*time.Hour)
+	refreshToken, err := app.generateAuthJWT(user, tokenTypeRefresh, session, session.RefreshTokenID)
 	if err != nil {
 		return "", "", err
 	}
@@ -33,28 +135,96 @@ func generateTokens(user *data.User) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-// generateAuthJWT generates a JWT token with the given user information, secret key, and expiration time
-func generateAuthJWT(user *data.User, secretKey string, expirationTime time.Duration) (string, error) {
-	// Set the expiration time for the token
-	expiration := time.Now().Add(expirationTime)
+// tokenKeys returns the key ring and lifetime of a token type
+func (app *application) tokenKeys(tokenType string) (*keyRing, time.Duration) {
+	switch tokenType {
+	case tokenTypeRefresh:
+		return app.refreshKeys, refreshTokenLifetime
+	case tokenTypeTwoFactor:
+		// Like refresh tokens, two-factor tokens are only read by this service
+		return app.refreshKeys, twoFactorTokenLifetime
+	default:
+		return app.accessKeys, accessTokenLifetime
+	}
+}
+
+// generateAuthJWT generates a JWT token of the given type for the user session,
+// signed with the current key of the token type. Two-factor tokens are issued
+// before the session exists and are generated without one.
+func (app *application) generateAuthJWT(user *data.User, tokenType string, session *data.Session, tokenID string) (string, error) {
+	keys, lifetime := app.tokenKeys(tokenType)
+	now := time.Now()
+	key, err := keys.current(now)
+	if err != nil {
+		return "", err
+	}
+
+	// Create the JWT claims
+	claims := &tokenClaims{
+		Email:     user.Email,
+		Role:      userRole(user),
+		Admin:     user.Role == data.RoleAdmin,
+		TokenType: tokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Issuer:    app.tokenIssuer,
+			Audience:  app.tokenAudience,
+			ExpiresAt: now.Add(lifetime).Unix(),
+			IssuedAt:  now.Unix(),
+			Subject:   strconv.Itoa(user.ID),
+		},
+	}
+	if session != nil {
+		claims.SessionID = session.ID
+		claims.AMR = []string{authMethodPassword}
+		if session.TwoFactor {
+			claims.AMR = append(claims.AMR, authMethodOTP)
+		}
+	}
+
+	return signJWT(key, claims)
+}
+
+// generateImpersonationJWT generates a short-lived access token that lets an
+// administrator act as the user. The token carries the session of the
+// administrator, so that it is revoked with that session, and names the
+// administrator in its act claim.
+func (app *application) generateImpersonationJWT(user *data.User, admin principal, readOnly bool) (string, error) {
+	now := time.Now()
+	key, err := app.accessKeys.current(now)
+	if err != nil {
+		return "", err
+	}
 
 	// Create the JWT claims
-	claims := &jwt.StandardClaims{
-		ExpiresAt: expiration.Unix(),
-		IssuedAt:  time.Now().Unix(),
-		Subject:   strconv.Itoa(user.ID),
+	claims := &tokenClaims{
+		Email:     user.Email,
+		Role:      userRole(user),
+		SessionID: admin.SessionID,
+		TokenType: tokenTypeAccess,
+		Actor:     &tokenActor{Subject: strconv.Itoa(admin.UserID), Email: admin.Email},
+		ReadOnly:  readOnly,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    app.tokenIssuer,
+			Audience:  app.tokenAudience,
+			ExpiresAt: now.Add(impersonationTokenLifetime).Unix(),
+			IssuedAt:  now.Unix(),
+			Subject:   strconv.Itoa(user.ID),
+		},
 	}
 
-	// Create the token with the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return signJWT(key, claims)
+}
 
-	// Sign the token with the provided secret key
-	key := []byte(secretKey)
-	if len(key) == 0 {
-		log.Fatal("JWT secret key is not set")
+// signJWT signs the claims with a key, naming the key in the token header
+func signJWT(key *signingKey, claims *tokenClaims) (string, error) {
+	// Create the token with the claims, naming the key it is signed with
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.id != "" {
+		token.Header["kid"] = key.id
 	}
 
-	signedToken, err := token.SignedString(key)
+	signedToken, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -62,90 +232,109 @@ func generateAuthJWT(user *data.User, secretKey string, expirationTime time.Dura
 	return signedToken, nil
 }
 
-// validateAccessToken validates the access token provided in the request header
-func validateAccessToken(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the access token from the Authorization header
-		accessToken := r.Header.Get("Authorization")
-		if accessToken == "" {
-			http.Error(w, "Access token is required", http.StatusBadRequest)
-			return
+// ensureSigningKeys generates random JWT signing keys for any key missing from
+// the environment. Tokens signed with generated keys stop validating after a restart.
+func ensureSigningKeys() error {
+	for _, name := range []string{"JWT_ACCESS_KEY", "JWT_REFRESH_KEY"} {
+		if os.Getenv(name) != "" {
+			continue
 		}
-
-		// Check if the token starts with the "Bearer " prefix
-		if strings.HasPrefix(accessToken, "Bearer ") {
-			// Remove the "Bearer " prefix from the token
-			accessToken = strings.TrimPrefix(accessToken, "Bearer ")
+		// The access key is not used when access tokens are signed with private keys
+		if name == "JWT_ACCESS_KEY" && os.Getenv("JWT_SIGNING_KEYS") != "" {
+			continue
 		}
 
-		// Log the received access token for debugging
-		fmt.Println("Received access token:", accessToken)
-
-		// Validate the access token expiration
-		if isTokenExpired(accessToken) {
-			http.Error(w, "Access token has expired", http.StatusUnauthorized)
-			return
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
 		}
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+		os.Setenv(name, hex.EncodeToString(key))
+		log.Printf("%s is not set, using a random key for this run", name)
+	}
+	return nil
 }
 
-// validateRefreshJWT validates the refresh token and retrieves user information
-func validateRefreshJWT(tokenString, secretKey string) (*data.User, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
+// parseJWT verifies the signature and expiry of a token of the given type and
+// returns its claims. Tokens of the other type, or issued for another issuer
+// or audience, are rejected.
+func (app *application) parseJWT(tokenString, tokenType string) (*tokenClaims, error) {
+	keys, _ := app.tokenKeys(tokenType)
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Only accept the key named in the kid header, with the algorithm it signs with
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.verifier(kid, time.Now())
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return key.verifyKey, nil
 	})
-
 	if err != nil {
 		return nil, err
 	}
-
-	claims, ok := token.Claims.(*jwt.StandardClaims)
-	if !ok || !token.Valid {
+	if !token.Valid {
 		return nil, errors.New("invalid token")
 	}
 
-	userID, err := strconv.Atoi(claims.Subject)
-	if err != nil {
-		return nil, errors.New("invalid user ID in token")
+	// A valid signature is not enough: the token must be meant for this use
+	if claims.TokenType != tokenType {
+		return nil, fmt.Errorf("expected a %s token, got %q", tokenType, claims.TokenType)
 	}
-
-	// Retrieve user information from the database
-	user, err := data.GetUserByID(userID)
-	if err != nil {
-		return nil, err
+	if app.tokenIssuer != "" && !claims.VerifyIssuer(app.tokenIssuer, true) {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if app.tokenAudience != "" && !claims.VerifyAudience(app.tokenAudience, true) {
+		return nil, errors.New("unexpected token audience")
 	}
 
-	return user, nil
+	return claims, nil
+}
+
+// parseAccessToken verifies an access token and returns its claims
+func (app *application) parseAccessToken(tokenString string) (*tokenClaims, error) {
+	return app.parseJWT(tokenString, tokenTypeAccess)
 }
 
-// isTokenExpired checks if the access token is expired
-func isTokenExpired(accessToken string) bool {
-	// Get user ID associated with the access token
-	userID, err := data.GetUserIDByAccessToken(accessToken)
+// validateRefreshJWT validates the refresh token and retrieves the user and
+// the session it was issued for. The session must still be active. When the
+// token is not the current refresh token of its session it returns the
+// session with data.ErrRefreshTokenReused.
+func (app *application) validateRefreshJWT(tokenString string) (*data.User, *data.Session, error) {
+	claims, err := app.parseJWT(tokenString, tokenTypeRefresh)
 	if err != nil {
-		fmt.Println("Error fetching user ID from access token:", err)
-		return true // Consider expired if unable to fetch user ID
+		return nil, nil, err
+	}
+	if claims.Id == "" {
+		return nil, nil, errors.New("refresh token has no ID")
 	}
 
-	// Get expiration time from the database
-	expirationTime, err := data.GetAccessTokenExpirationTime(userID)
+	userID, err := claims.userID()
 	if err != nil {
-		fmt.Println("Error fetching token expiration time:", err)
-		return true // Consider expired if unable to fetch expiration time
+		return nil, nil, err
 	}
 
-	fmt.Println("Expiration time from database:", expirationTime)
+	// Refuse refresh tokens whose session was revoked or has expired
+	session, err := app.store.GetSession(claims.SessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.UserID != userID || !session.Active(time.Now()) {
+		return nil, nil, data.ErrSessionNotFound
+	}
 
-	// Check if the current time is after the expiration time
-	currentTime := time.Now()
-	fmt.Println("Current time:", currentTime)
-	if currentTime.After(expirationTime) {
-		fmt.Println("Access token has expired")
-		return true
+	// Only the most recently issued refresh token of the session may be used
+	if claims.Id != session.RefreshTokenID {
+		return nil, session, data.ErrRefreshTokenReused
 	}
 
-	return false
+	// Retrieve user information from the database
+	user, err := app.store.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, session, nil
 }
@@ -3,103 +3,151 @@
 package main
 
 import (
-	"context"
-	"database/sql"
+	"backend-project/data"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math/big"
 	"net/http"
-	"os"
 	"time"
 )
 
-var db *sql.DB
-var dbTimeout = 5 * time.Second
-
 // RefreshTokenHandler handles the refreshing of access tokens
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the refresh token from the Authorization header
-	refreshToken := r.Header.Get("Authorization")
+	refreshToken := bearerToken(r)
 	if refreshToken == "" {
 		http.Error(w, "Refresh token is required", http.StatusBadRequest)
 		return
 	}
 
-	// Remove the "Bearer " prefix from the token
-	refreshToken = refreshToken[len("Bearer "):]
+	app.refreshAccessToken(w, r, refreshToken)
+}
 
-	// Validate the refresh token and get the user information
-	user, err := validateRefreshJWT(refreshToken, os.Getenv("JWT_REFRESH_KEY"))
+// refreshAccessToken is a helper function for refreshing the access token.
+// Every refresh also rotates the refresh token: the one presented can not be
+// used again, and presenting it again revokes the session.
+func (app *application) refreshAccessToken(w http.ResponseWriter, r *http.Request, refreshToken string) {
+	// Validate the refresh token and get the user and session information
+	user, session, err := app.validateRefreshJWT(refreshToken)
+	if errors.Is(err, data.ErrRefreshTokenReused) {
+		app.revokeReusedSession(r, session)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate a new access token
-	accessToken, err := generateAuthJWT(user, os.Getenv("JWT_ACCESS_KEY"), 30*time.Minute)
+	// Generate a new access token and refresh token for the same session
+	refreshTokenID, err := newTokenID()
 	if err != nil {
-		fmt.Println("Error generating access JWT token:", err)
+		fmt.Println("Error generating refresh token ID:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	rotated := *session
+	rotated.RefreshTokenID = refreshTokenID
+	accessToken, newRefreshToken, err := app.generateTokens(user, &rotated)
+	if err != nil {
+		fmt.Println("Error generating tokens:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Update the access token and its expiration time in the database
-	err = updateAccessToken(db, dbTimeout, user.ID, accessToken, 30*time.Minute)
+	// Replace the refresh token of the session, which also invalidates the one presented
+	err = app.store.RotateRefreshToken(session.ID, session.RefreshTokenID, refreshTokenID, time.Now())
+	if errors.Is(err, data.ErrRefreshTokenReused) {
+		// Another request rotated the same refresh token first
+		app.revokeReusedSession(r, session)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		fmt.Println("Error updating access token:", err)
+		fmt.Println("Error rotating refresh token:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Respond with the new access token
-	response := map[string]interface{}{"message": "Token refreshed successfully", "accessToken": accessToken}
+	// Respond with the new tokens
+	response := map[string]interface{}{
+		"message":      "Token refreshed successfully",
+		"accessToken":  accessToken,
+		"refreshToken": newRefreshToken,
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// updateAccessToken updates the access token and its expiration time in the database
-func updateAccessToken(db *sql.DB, timeout time.Duration, userID int, newAccessToken string, validityDuration time.Duration) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Calculate the new expiration time
-	expiresAt := time.Now().Add(validityDuration)
-
-	stmt := `
-        UPDATE access_tokens
-        SET accessJWT = ?, expires_at = ?
-        WHERE user_id = ?`
+// revokeReusedSession revokes a session whose refresh token was used twice,
+// as either the client or an attacker holds a stolen token, and records the
+// reuse as a security event
+func (app *application) revokeReusedSession(r *http.Request, session *data.Session) {
+	now := time.Now()
+	log.Printf("Refresh token reuse detected for session %d of user %d, revoking the session", session.ID, session.UserID)
 
-	_, err := db.ExecContext(ctx, stmt, newAccessToken, expiresAt, userID)
-	return err
-}
-
-// refreshAccessToken is a helper function for refreshing the access token
-func refreshAccessToken(w http.ResponseWriter, r *http.Request, refreshToken string, db *sql.DB) {
-	// Validate the refresh token and get the user information
-	user, err := validateRefreshJWT(refreshToken, os.Getenv("JWT_REFRESH_KEY"))
-	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
-		return
+	err := app.store.RevokeSession(session.UserID, session.ID, now)
+	if err != nil && !errors.Is(err, data.ErrSessionNotFound) {
+		log.Printf("Failed to revoke session %d: %v", session.ID, err)
 	}
-
-	// Generate a new access token
-	accessToken, err := generateAuthJWT(user, os.Getenv("JWT_ACCESS_KEY"), 30*time.Minute)
+	app.revocations.forget(session.ID)
+
+	sessionID := session.ID
+	_, err = app.store.RecordSecurityEvent(&data.SecurityEvent{
+		UserID:    session.UserID,
+		SessionID: &sessionID,
+		Type:      data.SecurityEventRefreshTokenReuse,
+		IPAddress: clientIP(r),
+		UserAgent: truncateUserAgent(r.UserAgent()),
+		Details:   "A refresh token was used more than once; the session was revoked",
+		CreatedAt: now,
+	})
 	if err != nil {
-		fmt.Println("Error generating access JWT token:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		log.Printf("Failed to record security event for user %d: %v", session.UserID, err)
 	}
+}
 
-	// Update the access token in the database
-	err = updateAccessToken(db, dbTimeout, user.ID, accessToken, 30*time.Minute)
-	if err != nil {
-		fmt.Println("Error updating access token:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+// jsonWebKey is a public key in JSON Web Key format (RFC 7517)
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"` // Ed25519 keys
+	X         string `json:"x,omitempty"`   // Ed25519 keys
+	Modulus   string `json:"n,omitempty"`   // RSA keys
+	Exponent  string `json:"e,omitempty"`   // RSA keys
+}
+
+// JWKSHandler publishes the public keys access tokens can be verified with,
+// so that other services can check them without sharing a secret. It lists
+// no keys when access tokens are signed with the HS256 secret.
+func (app *application) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys := []jsonWebKey{}
+	for _, key := range app.accessKeys.published(time.Now()) {
+		jwk := jsonWebKey{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
 	}
 
-	// Respond with the new access token
-	response := map[string]interface{}{"message": "Token refreshed successfully", "accessToken": accessToken}
+	// Verifiers may cache the keys; scheduled keys are listed ahead of use
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
 }
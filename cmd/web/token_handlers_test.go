@@ -0,0 +1,47 @@
+// token_handlers_test.go
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRefreshTokenHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+	registerUser(t, app, "user@example.com", "secret")
+	accessToken, refreshToken := login(t, app, "user@example.com", "secret")
+
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("without a token: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, accessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("with an access token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// A refresh returns new tokens for the same session
+	w := request(t, app, http.MethodPost, "/tokens/refresh", nil, refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	newAccessToken, _ := body["accessToken"].(string)
+	newRefreshToken, _ := body["refreshToken"].(string)
+	if newAccessToken == "" || newRefreshToken == "" || newRefreshToken == refreshToken {
+		t.Fatalf("refresh did not rotate the tokens: %v", body)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, newAccessToken); w.Code != http.StatusOK {
+		t.Errorf("profile with the new access token: status %d", w.Code)
+	}
+
+	// Presenting the old refresh token again revokes the whole session
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, refreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(t, app, http.MethodPost, "/tokens/refresh", nil, newRefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of the revoked session: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := request(t, app, http.MethodGet, "/profile", nil, newAccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token of the revoked session: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
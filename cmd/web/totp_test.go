@@ -0,0 +1,70 @@
+// totp_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the HMAC-SHA1 key of the RFC 6238 test vectors
+var rfc6238Secret = []byte("12345678901234567890")
+
+// TestTotpCodeRFC6238 checks the codes against the SHA1 test vectors of RFC
+// 6238 appendix B, which have 8 digits; 6-digit codes are their last 6 digits.
+func TestTotpCodeRFC6238(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		step := totpStep(time.Unix(v.unix, 0))
+		want := v.code[len(v.code)-totpDigits:]
+		if got := totpCode(rfc6238Secret, step); got != want {
+			t.Errorf("totpCode at %d = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+// TestVerifyTotp checks the accepted clock drift and the step returned
+func TestVerifyTotp(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	tests := []struct {
+		name   string
+		step   int64
+		accept bool
+	}{
+		{"current step", current, true},
+		{"previous step", current - 1, true},
+		{"next step", current + 1, true},
+		{"two steps ago", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+	for _, tt := range tests {
+		step, ok := verifyTotp(secret, totpCode(rfc6238Secret, tt.step), now)
+		if ok != tt.accept {
+			t.Errorf("%s: accepted = %v, want %v", tt.name, ok, tt.accept)
+		}
+		if ok && step != tt.step {
+			t.Errorf("%s: step = %d, want %d", tt.name, step, tt.step)
+		}
+	}
+
+	if _, ok := verifyTotp(secret, "12345", now); ok {
+		t.Error("a code with too few digits was accepted")
+	}
+	if _, ok := verifyTotp("not base32!", totpCode(rfc6238Secret, current), now); ok {
+		t.Error("a code was accepted for an invalid secret")
+	}
+}
@@ -0,0 +1,518 @@
+// two_factor_handlers.go
+
+package main
+
+import (
+	"backend-project/data"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTwoFactorIssuer is the name authenticator apps show next to the account
+const defaultTwoFactorIssuer = "Ticket Platform"
+
+// Two-factor limits. After maxTwoFactorAttempts wrong codes in a row, codes
+// are refused until twoFactorLockout after the last wrong one.
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	maxTwoFactorAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// recoveryCodeAlphabet avoids characters that are easily confused when copied by hand
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// errSecondFactorIncorrect is returned when the code entered is wrong or was already used
+var errSecondFactorIncorrect = errors.New("incorrect two-factor code")
+
+// twoFactorLockedError is returned while codes are refused after too many wrong ones
+type twoFactorLockedError struct {
+	retryAfter time.Duration
+}
+
+func (e *twoFactorLockedError) Error() string {
+	return fmt.Sprintf("two-factor authentication locked for %s", e.retryAfter)
+}
+
+// twoFactorSettings reads TWO_FACTOR_ISSUER and TWO_FACTOR_REQUIRED_FOR_STAFF.
+// TWO_FACTOR_REQUIRED_FOR_ADMINS, its former name, is read when it is not set.
+func twoFactorSettings() (string, bool, error) {
+	issuer := os.Getenv("TWO_FACTOR_ISSUER")
+	if issuer == "" {
+		issuer = defaultTwoFactorIssuer
+	}
+
+	required := false
+	for _, name := range []string{"TWO_FACTOR_REQUIRED_FOR_STAFF", "TWO_FACTOR_REQUIRED_FOR_ADMINS"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		var err error
+		if required, err = strconv.ParseBool(value); err != nil {
+			return "", false, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		break
+	}
+	return issuer, required, nil
+}
+
+// newRecoveryCodes returns a new set of recovery codes, formatted for the
+// user, and the hashes that are stored
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	// Random bytes beyond the last whole multiple of the alphabet size are
+	// skipped, so that every character is equally likely
+	limit := 256 - 256%len(recoveryCodeAlphabet)
+	random := make([]byte, 1)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := make([]byte, 0, recoveryCodeLength)
+		for len(code) < recoveryCodeLength {
+			if _, err := rand.Read(random); err != nil {
+				return nil, nil, err
+			}
+			if int(random[0]) < limit {
+				code = append(code, recoveryCodeAlphabet[int(random[0])%len(recoveryCodeAlphabet)])
+			}
+		}
+		codes = append(codes, string(code[:5])+"-"+string(code[5:]))
+		hashes = append(hashes, hashToken(string(code)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode removes the separators and case a user may type a recovery code with
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// verifySecondFactor checks a TOTP code of the user or, when code is empty,
+// one of their recovery codes, which is then used up. Wrong codes count
+// towards the lockout; a *twoFactorLockedError is returned while it lasts.
+func (app *application) verifySecondFactor(r *http.Request, twoFactor *data.TwoFactor, code, recoveryCode string) error {
+	now := time.Now()
+
+	// A lockout that has passed starts a new count
+	if twoFactor.LastFailedAt != nil && !now.Before(twoFactor.LastFailedAt.Add(twoFactorLockout)) {
+		if err := app.store.ResetTwoFactorAttempts(twoFactor.UserID, twoFactor.FailedAttempts); err != nil {
+			return err
+		}
+	}
+
+	// Claim an attempt before checking the code, so that the limit holds
+	// under concurrent guesses. An accepted code clears the count.
+	attempts, err := app.store.RecordTwoFactorAttempt(twoFactor.UserID, maxTwoFactorAttempts, now)
+	if errors.Is(err, data.ErrTwoFactorAttemptsExceeded) {
+		retryAfter := twoFactorLockout
+		if twoFactor.LastFailedAt != nil {
+			if wait := twoFactor.LastFailedAt.Add(twoFactorLockout).Sub(now); wait > 0 {
+				retryAfter = wait
+			}
+		}
+		return &twoFactorLockedError{retryAfter: retryAfter}
+	}
+	if err != nil {
+		return err
+	}
+
+	if code != "" {
+		step, ok := verifyTotp(twoFactor.Secret, code, now)
+		if !ok {
+			err = errSecondFactorIncorrect
+		} else if err = app.store.UseTotpStep(twoFactor.UserID, step); errors.Is(err, data.ErrTotpCodeReused) {
+			// A code can only be used once, so that an observed code can not be replayed
+			err = errSecondFactorIncorrect
+		}
+	} else {
+		err = app.store.UseRecoveryCode(twoFactor.UserID, hashToken(normalizeRecoveryCode(recoveryCode)), now)
+		if errors.Is(err, data.ErrRecoveryCodeNotFound) {
+			err = errSecondFactorIncorrect
+		}
+		if err == nil {
+			app.recordSecurityEvent(r, twoFactor.UserID, data.SecurityEventRecoveryCodeUsed, "A recovery code was used instead of the authenticator")
+		}
+	}
+
+	// The wrong code that used up the last attempt starts the lockout
+	if errors.Is(err, errSecondFactorIncorrect) && attempts >= maxTwoFactorAttempts {
+		return &twoFactorLockedError{retryAfter: twoFactorLockout}
+	}
+	return err
+}
+
+// writeSecondFactorError responds to a second factor that was not accepted.
+// incorrectStatus is the status for a wrong code. It reports false for
+// unexpected errors, which the caller handles.
+func writeSecondFactorError(w http.ResponseWriter, err error, incorrectStatus int) bool {
+	var locked *twoFactorLockedError
+	switch {
+	case errors.Is(err, errSecondFactorIncorrect):
+		http.Error(w, "Invalid two-factor code", incorrectStatus)
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.retryAfter.Seconds()))))
+		http.Error(w, "Too many invalid two-factor codes, try again later", http.StatusTooManyRequests)
+	default:
+		return false
+	}
+	return true
+}
+
+// TwoFactorLoginHandler completes a login that requires a second factor,
+// with the two-factor token returned by /login and a TOTP or recovery code
+func (app *application) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TwoFactorToken string `json:"twoFactorToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.Code == "" && request.RecoveryCode == "" {
+		http.Error(w, "A code or recovery code is required", http.StatusBadRequest)
+		return
+	}
+
+	// The two-factor token proves the password was checked a few minutes ago
+	claims, err := app.parseJWT(request.TwoFactorToken, tokenTypeTwoFactor)
+	if err != nil {
+		unauthorized(w, "Invalid or expired two-factor token, log in again")
+		return
+	}
+	userID, err := claims.userID()
+	if err != nil {
+		unauthorized(w, "Invalid or expired two-factor token, log in again")
+		return
+	}
+
+	user, err := app.store.GetUserByID(userID)
+	if err != nil {
+		unauthorized(w, "Invalid or expired two-factor token, log in again")
+		return
+	}
+	if user.UserActive != 1 {
+		http.Error(w, "User does not exist or has not been activated. Please try re-registering your account", http.StatusForbidden)
+		return
+	}
+	if user.DeactivatedAt != nil {
+		http.Error(w, "This account has been deactivated. Please contact support.", http.StatusForbidden)
+		return
+	}
+
+	twoFactor, err := app.store.GetTwoFactor(user.ID)
+	if err != nil || !twoFactor.Enabled() {
+		// Two-factor authentication was turned off since the password was checked
+		unauthorized(w, "Invalid or expired two-factor token, log in again")
+		return
+	}
+
+	if err := app.verifySecondFactor(r, twoFactor, request.Code, request.RecoveryCode); err != nil {
+		if writeSecondFactorError(w, err, http.StatusUnauthorized) {
+			return
+		}
+		log.Println("Error verifying two-factor code:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.completeLogin(w, r, user, true)
+}
+
+// TwoFactorStatusHandler reports whether the authenticated user has
+// two-factor authentication enabled
+func (app *application) TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r)
+	response := map[string]interface{}{
+		"enabled":  false,
+		"pending":  false,
+		"required": app.staffTwoFactorRequired && p.isStaff(),
+	}
+
+	twoFactor, err := app.store.GetTwoFactor(p.UserID)
+	if err != nil && !errors.Is(err, data.ErrTwoFactorNotFound) {
+		log.Println("Error retrieving two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor != nil {
+		response["enabled"] = twoFactor.Enabled()
+		response["pending"] = !twoFactor.Enabled()
+	}
+	if twoFactor != nil && twoFactor.Enabled() {
+		remaining, err := app.store.CountRecoveryCodes(p.UserID)
+		if err != nil {
+			log.Println("Error counting recovery codes:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		response["recoveryCodesRemaining"] = remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// EnrolTwoFactorHandler starts TOTP enrolment for the authenticated user. It
+// returns a new secret and its provisioning URI, which clients show as a QR
+// code. Enrolment completes when a first code is confirmed.
+func (app *application) EnrolTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Starting two-factor enrolment...")
+
+	p := principalFrom(r)
+	twoFactor, err := app.store.GetTwoFactor(p.UserID)
+	if err != nil && !errors.Is(err, data.ErrTwoFactorNotFound) {
+		log.Println("Error retrieving two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor != nil && twoFactor.Enabled() {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	// The account name shown by the app is the current email address, which the token may predate
+	email, err := app.store.GetUserEmailByID(p.UserID)
+	if err != nil {
+		log.Println("Error retrieving user email:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := newTotpSecret()
+	if err != nil {
+		log.Println("Error generating TOTP secret:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	err = app.store.CreateTwoFactor(&data.TwoFactor{
+		UserID:    p.UserID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Println("Error storing TOTP secret:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "Scan the provisioning URI with an authenticator app, then confirm a code at /2fa/enable",
+		"secret":          secret,
+		"provisioningUri": totpProvisioningURI(app.twoFactorIssuer, email, secret),
+	})
+}
+
+// EnableTwoFactorHandler completes TOTP enrolment with a first code from the
+// authenticator app and returns the recovery codes, which are only shown once
+func (app *application) EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Enabling two-factor authentication...")
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	p := principalFrom(r)
+	twoFactor, err := app.store.GetTwoFactor(p.UserID)
+	if errors.Is(err, data.ErrTwoFactorNotFound) {
+		http.Error(w, "Start enrolment at /2fa/enrol first", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor.Enabled() {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := verifyTotp(twoFactor.Secret, request.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Println("Error generating recovery codes:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.store.EnableTwoFactor(p.UserID, step, hashes, time.Now()); err != nil {
+		if errors.Is(err, data.ErrTwoFactorNotFound) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		log.Println("Error enabling two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordSecurityEvent(r, p.UserID, data.SecurityEventTwoFactorEnabled, "TOTP two-factor authentication was enabled")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Two-factor authentication enabled. Store the recovery codes safely; they are not shown again",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactorHandler removes the authenticator of the authenticated
+// user, who must confirm their password and a current code or recovery code.
+// A pending enrolment is cancelled with the password alone.
+func (app *application) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Disabling two-factor authentication...")
+
+	var request struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	p := principalFrom(r)
+	if app.staffTwoFactorRequired && p.isStaff() {
+		http.Error(w, "Two-factor authentication is required for staff", http.StatusForbidden)
+		return
+	}
+
+	user, err := app.store.GetUserByID(p.UserID)
+	if err != nil {
+		log.Println("Error retrieving user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	matches, err := user.PasswordMatches(request.Password)
+	if err != nil {
+		log.Println("Error comparing passwords:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !matches {
+		http.Error(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	twoFactor, err := app.store.GetTwoFactor(p.UserID)
+	if errors.Is(err, data.ErrTwoFactorNotFound) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor.Enabled() {
+		if request.Code == "" && request.RecoveryCode == "" {
+			http.Error(w, "A code or recovery code is required", http.StatusBadRequest)
+			return
+		}
+		if err := app.verifySecondFactor(r, twoFactor, request.Code, request.RecoveryCode); err != nil {
+			if writeSecondFactorError(w, err, http.StatusForbidden) {
+				return
+			}
+			log.Println("Error verifying two-factor code:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := app.store.DeleteTwoFactor(p.UserID); err != nil && !errors.Is(err, data.ErrTwoFactorNotFound) {
+		log.Println("Error disabling two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor.Enabled() {
+		app.recordSecurityEvent(r, p.UserID, data.SecurityEventTwoFactorDisabled, "TOTP two-factor authentication was disabled")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the
+// authenticated user after confirming a code from the authenticator app
+func (app *application) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	// Log the start of the handler
+	log.Println("Regenerating recovery codes...")
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.Code == "" {
+		http.Error(w, "A code from the authenticator app is required", http.StatusBadRequest)
+		return
+	}
+
+	p := principalFrom(r)
+	twoFactor, err := app.store.GetTwoFactor(p.UserID)
+	if err != nil && !errors.Is(err, data.ErrTwoFactorNotFound) {
+		log.Println("Error retrieving two-factor authentication:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor == nil || !twoFactor.Enabled() {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.verifySecondFactor(r, twoFactor, request.Code, ""); err != nil {
+		if writeSecondFactorError(w, err, http.StatusForbidden) {
+			return
+		}
+		log.Println("Error verifying two-factor code:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Println("Error generating recovery codes:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.store.ReplaceRecoveryCodes(p.UserID, hashes); err != nil {
+		log.Println("Error storing recovery codes:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	app.recordSecurityEvent(r, p.UserID, data.SecurityEventRecoveryCodesRegenerated, "The recovery codes were replaced")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Recovery codes replaced. Store them safely; they are not shown again",
+		"recoveryCodes": codes,
+	})
+}
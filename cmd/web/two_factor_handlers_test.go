@@ -0,0 +1,121 @@
+// two_factor_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestStaffTwoFactorRequired checks that an agent without two-factor
+// authentication is held to the same policy as administrators
+func TestStaffTwoFactorRequired(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.staffTwoFactorRequired = true
+	registerStaff(t, app, "agent@example.com", data.RoleAgent)
+
+	w := request(t, app, http.MethodPost, "/login", map[string]string{"email": "agent@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	if body["twoFactorEnrolmentRequired"] != true {
+		t.Error("the login did not say two-factor authentication must be enrolled")
+	}
+	accessToken := body["accessToken"].(string)
+
+	if w := request(t, app, http.MethodGet, "/admin/tickets", nil, accessToken); w.Code != http.StatusForbidden {
+		t.Errorf("admin endpoint without a second factor: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = request(t, app, http.MethodGet, "/2fa", nil, accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("2FA status: status %d", w.Code)
+	}
+	if decode(t, w)["required"] != true {
+		t.Error("two-factor authentication is not reported as required")
+	}
+
+	// Enrol, then log in again with a code
+	w = request(t, app, http.MethodPost, "/2fa/enrol", nil, accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enrol: status %d: %s", w.Code, w.Body.String())
+	}
+	secret, err := totpEncoding.DecodeString(decode(t, w)["secret"].(string))
+	if err != nil {
+		t.Fatalf("decoding the secret: %v", err)
+	}
+	step := totpStep(time.Now())
+	w = request(t, app, http.MethodPost, "/2fa/enable", map[string]string{"code": totpCode(secret, step)}, accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = request(t, app, http.MethodPost, "/login", map[string]string{"email": "agent@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	twoFactorToken := decode(t, w)["twoFactorToken"].(string)
+	w = request(t, app, http.MethodPost, "/login/2fa", map[string]string{"twoFactorToken": twoFactorToken, "code": totpCode(secret, step+1)}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("second factor: status %d: %s", w.Code, w.Body.String())
+	}
+	accessToken = decode(t, w)["accessToken"].(string)
+
+	if w := request(t, app, http.MethodGet, "/admin/tickets", nil, accessToken); w.Code != http.StatusOK {
+		t.Errorf("admin endpoint with a second factor: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Staff cannot turn two-factor authentication off while it is required
+	w = request(t, app, http.MethodPost, "/2fa/disable", map[string]string{"password": "secret", "code": totpCode(secret, step+1)}, accessToken)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("disable: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// TestTwoFactorNotRequiredForCustomers checks that the policy leaves customers alone
+func TestTwoFactorNotRequiredForCustomers(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.staffTwoFactorRequired = true
+	registerUser(t, app, "customer@example.com", "secret")
+
+	w := request(t, app, http.MethodPost, "/login", map[string]string{"email": "customer@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	if body["twoFactorEnrolmentRequired"] != nil {
+		t.Error("a customer was told to enrol two-factor authentication")
+	}
+
+	w = request(t, app, http.MethodGet, "/2fa", nil, body["accessToken"].(string))
+	if w.Code != http.StatusOK {
+		t.Fatalf("2FA status: status %d", w.Code)
+	}
+	if decode(t, w)["required"] != false {
+		t.Error("two-factor authentication is reported as required for a customer")
+	}
+}
+
+func TestTwoFactorSettings(t *testing.T) {
+	tests := []struct {
+		staff, admins string
+		required      bool
+		fails         bool
+	}{
+		{"", "", false, false},
+		{"true", "", true, false},
+		{"", "true", true, false},
+		{"false", "true", false, false},
+		{"maybe", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TWO_FACTOR_REQUIRED_FOR_STAFF", tt.staff)
+		t.Setenv("TWO_FACTOR_REQUIRED_FOR_ADMINS", tt.admins)
+		_, required, err := twoFactorSettings()
+		if (err != nil) != tt.fails || required != tt.required {
+			t.Errorf("staff %q, admins %q: required = %v, error = %v", tt.staff, tt.admins, required, err)
+		}
+	}
+}
@@ -9,21 +9,37 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"time"
 )
 
 // RegisterHandler handles user registration
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var user data.User
-	err := json.NewDecoder(r.Body).Decode(&user)
+func (app *application) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	// Only the fields users may choose are read from the request
+	var registration struct {
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&registration)
 	if err != nil {
 		log.Println("Error decoding request payload:", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
+	// New users are customers; roles are only changed by administrators.
+	// Accounts are only activated by verifying the emailed PIN.
+	user := data.User{
+		Email:      registration.Email,
+		FirstName:  registration.FirstName,
+		LastName:   registration.LastName,
+		UserActive: 0,
+		Role:       data.RoleCustomer,
+	}
+
 	// Check if the user already exists
-	exists, err := data.UserExists(user.Email)
+	exists, err := app.store.UserExists(user.Email)
 	if err != nil {
 		log.Println("Error checking user existence:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -34,54 +50,53 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate a pin number for verification
-	pinNumber, err := data.GeneratePinNumber()
-	if err != nil {
-		log.Println("Error generating pin number:", err)
-		http.Error(w, "Error generating pin number", http.StatusInternalServerError)
+	// Hash the user's password before it is stored
+	if err := user.SetPassword(registration.Password); err != nil {
+		log.Println("Error hashing password:", err)
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
-	// Set the generated pin number for the user
-	user.PinNumber = pinNumber
+	// The PIN is stored separately, hashed; the user row never holds it
+	user.PinNumber = ""
 
 	// Create the user in the database
-	userID, err := user.Create()
+	userID, err := app.store.CreateUser(&user)
 	if err != nil {
 		log.Println("Error creating user:", err)
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
-	// Retrieve the PIN from the database to ensure consistency
-	savedPin, err := data.GetPinByEmail(user.Email)
+	// Generate a pin number for verification
+	pin, err := app.issuePin(userID, data.PinPurposeAccount)
 	if err != nil {
-		log.Println("Error retrieving PIN from the database:", err)
-		http.Error(w, "Error retrieving PIN from the database", http.StatusInternalServerError)
+		log.Println("Error generating pin number:", err)
+		http.Error(w, "Error generating pin number", http.StatusInternalServerError)
 		return
 	}
 
 	// Send the PIN via email
-	body := fmt.Sprintf("Verification code for user %s: %s", user.Email, savedPin)
-	err = sendPinByEmail(user.Email, body) // This line calls the sendPinByEmail function
-	if err != nil {
+	if err := sendPinByEmail(user.Email, pin); err != nil {
 		log.Println("Error sending PIN via email:", err)
 		http.Error(w, "Error sending PIN via email", http.StatusInternalServerError)
 		return
 	}
 
-	// Respond with success message and include the PIN in the response - would not normally include PIN in response but I have done so if someone without access to the Mailtrap account would look to test APIs
+	// Respond with success message; the PIN is only included when PIN_IN_RESPONSE is set
 	response := map[string]interface{}{
 		"message": "User registered successfully",
 		"userID":  userID,
-		"pin":     savedPin, // Include the PIN in the response
+	}
+	if app.echoPins {
+		response["pin"] = pin
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 // VerifyPinHandler handles PIN verification
-func VerifyPinHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) VerifyPinHandler(w http.ResponseWriter, r *http.Request) {
 	var pinVerification struct {
 		Email string `json:"email"`
 		Pin   string `json:"pin"`
@@ -94,31 +109,35 @@ func VerifyPinHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve the user by email
-	user, err := data.GetUserByEmail(pinVerification.Email)
+	user, err := app.store.GetUserByEmail(pinVerification.Email)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-
-	// Retrieve the PIN for the user from the database
-	savedPin, err := data.GetPinByEmail(pinVerification.Email)
-	if err != nil {
-		http.Error(w, "Error retrieving PIN from the database", http.StatusInternalServerError)
+	if user.UserActive == 1 {
+		http.Error(w, "Account already verified", http.StatusBadRequest)
 		return
 	}
 
-	// Compare the provided PIN with the one retrieved from the database
-	if savedPin != pinVerification.Pin {
-		http.Error(w, "Invalid PIN", http.StatusUnauthorized)
+	// Compare the provided PIN with the hash stored for the user
+	if err := app.checkPin(user.ID, data.PinPurposeAccount, pinVerification.Pin); err != nil {
+		if writePinError(w, err, http.StatusUnauthorized) {
+			return
+		}
+		log.Println("Error checking PIN:", err)
+		http.Error(w, "Error retrieving PIN from the database", http.StatusInternalServerError)
 		return
 	}
 
 	// Update the pin_number field to indicate verification
-	user.PinNumber = "N/A - verified" // Set the new value for pin_number
-	if err := user.UpdatePinAfterVerification(); err != nil {
+	user.PinNumber = data.PinVerified // Set the new value for pin_number
+	if err := app.store.UpdatePinAfterVerification(user.ID); err != nil {
 		http.Error(w, "Error updating PIN after verification", http.StatusInternalServerError)
 		return
 	}
+	if err := app.store.DeleteVerificationPin(user.ID, data.PinPurposeAccount); err != nil {
+		log.Println("Error deleting used PIN:", err)
+	}
 
 	// Respond with a success message
 	response := map[string]interface{}{"message": "PIN verified successfully"}
@@ -126,8 +145,55 @@ func VerifyPinHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// resendPinMessage is the answer to every accepted PIN resend request, so
+// that it does not tell which accounts are awaiting verification
+const resendPinMessage = "If the account is awaiting verification, a new PIN has been sent"
+
+// ResendPinHandler emails a new account verification PIN, replacing the
+// previous one. New PINs can only be requested once per cooldown period.
+func (app *application) ResendPinHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{"message": resendPinMessage}
+
+	user, err := app.store.GetUserByEmail(request.Email)
+	if err != nil && !errors.Is(err, data.ErrUserNotFound) {
+		log.Println("Error retrieving user:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if user != nil && user.UserActive != 1 {
+		pin, err := app.issuePin(user.ID, data.PinPurposeAccount)
+		if err != nil {
+			if writePinCooldown(w, err) {
+				return
+			}
+			log.Println("Error generating pin number:", err)
+			http.Error(w, "Error generating pin number", http.StatusInternalServerError)
+			return
+		}
+		if err := sendPinByEmail(user.Email, pin); err != nil {
+			log.Println("Error sending PIN via email:", err)
+			http.Error(w, "Error sending PIN via email", http.StatusInternalServerError)
+			return
+		}
+		if app.echoPins {
+			response["pin"] = pin
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // LoginHandler handles user login
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var credentials struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -140,19 +206,38 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse logins for a while after too many failed attempts
+	throttled, err := app.checkLoginAllowed(r, credentials.Email)
+	if err != nil {
+		fmt.Println("Error checking failed logins:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if throttled != nil {
+		writeLoginThrottled(w, throttled)
+		return
+	}
+
 	// Authenticate the user
-	user, err := data.AuthenticateUser(credentials.Email, credentials.Password)
+	user, err := data.AuthenticateUser(app.store, credentials.Email, credentials.Password)
 	if err != nil {
-		if errors.Is(err, data.ErrUserNotFound) {
-			// If the user is not found, return a specific response
-			http.Error(w, "User does not exist or has not been activated. Please try re-registering your account", http.StatusNotFound)
-			return
-		} else {
-			// For other authentication errors, return generic unauthorized response
+		if !errors.Is(err, data.ErrUserNotFound) && !errors.Is(err, data.ErrInvalidCredentials) {
 			fmt.Println("Error authenticating user:", err)
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+
+		// Unknown email addresses and wrong passwords get the same response
+		if err := app.recordLoginFailure(r, credentials.Email); err != nil {
+			fmt.Println("Error recording failed login:", err)
+		}
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	// A successful login forgets the failed attempts with this address
+	if err := app.store.ClearLoginFailures(credentials.Email); err != nil {
+		fmt.Println("Error clearing failed logins:", err)
 	}
 
 	// Check if the user is active
@@ -162,36 +247,68 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Insert the access token and update/insert the refresh token into the database
-	accessToken, refreshToken, err := generateTokens(user)
-	if err != nil {
-		fmt.Println("Error generating tokens:", err)
+	// Deactivated users can no longer log in
+	if user.DeactivatedAt != nil {
+		http.Error(w, "This account has been deactivated. Please contact support.", http.StatusForbidden)
+		return
+	}
+
+	// Users with an authenticator confirm the login with a code first
+	twoFactor, err := app.store.GetTwoFactor(user.ID)
+	if err != nil && !errors.Is(err, data.ErrTwoFactorNotFound) {
+		fmt.Println("Error retrieving two-factor authentication:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	if twoFactor != nil && twoFactor.Enabled() {
+		twoFactorToken, err := app.generateAuthJWT(user, tokenTypeTwoFactor, nil, "")
+		if err != nil {
+			fmt.Println("Error generating two-factor token:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":           "Two-factor authentication required",
+			"twoFactorRequired": true,
+			"twoFactorToken":    twoFactorToken,
+		})
+		return
+	}
 
-	// Insert the access token into the database
-	_, err = data.CreateAccessToken(user.ID, user.Email, accessToken)
+	app.completeLogin(w, r, user, false)
+}
+
+// completeLogin starts a session for an authenticated user and responds with
+// its tokens. twoFactor records whether the login was confirmed with a second factor.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User, twoFactor bool) {
+	// Start a new session for this login, alongside any other sessions of the user
+	session, err := app.startSession(r, user.ID, twoFactor)
 	if err != nil {
-		fmt.Println("Error inserting access token into the database:", err)
+		fmt.Println("Error creating session:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Update or insert the refresh token into the database
-	err = data.UpdateRefreshToken(user.ID, refreshToken)
+	// Generate the access and refresh tokens for the session
+	accessToken, refreshToken, err := app.generateTokens(user, session)
 	if err != nil {
-		fmt.Println("Error updating refresh token:", err)
+		fmt.Println("Error generating tokens:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	response := map[string]interface{}{
 		"message":      "Login successful",
-		"user":         user,
+		"user":         newUserProfile(user),
 		"accessToken":  accessToken,
 		"refreshToken": refreshToken,
 	}
+	// Tell staff who must use two-factor authentication that they can not use admin endpoints yet
+	if app.staffTwoFactorRequired && data.StaffRole(user.Role) && !twoFactor {
+		response["twoFactorEnrolmentRequired"] = true
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -199,47 +316,22 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("User %s successfully logged in\n", user.Email)
 }
 
-// LogoutHandler handles user logout
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	// Print the request URL and headers for debugging
-	fmt.Println("Request URL:", r.URL)
-	fmt.Println("Request Headers:", r.Header)
-
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		fmt.Println("No access token provided")
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
+// LogoutHandler handles user logout. Only the session of the access token is
+// ended; the user's other sessions stay signed in.
+func (app *application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// The user was authenticated from the access token by the middleware
+	p := principalFrom(r)
 
-	// Remove the "Bearer " prefix from the token
-	accessToken = strings.TrimPrefix(accessToken, "Bearer ")
+	fmt.Printf("User with ID %d is logging out\n", p.UserID)
 
-	// Retrieve user ID from the database using the access token
-	userID, err := data.GetUserIDByAccessToken(accessToken)
-	if err != nil {
-		fmt.Println("Error retrieving user ID from access tokens table:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Retrieve the user from the database based on the user ID
-	user, err := data.GetUserByID(userID)
-	if err != nil {
-		fmt.Println("Error retrieving user from the database:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Printf("User with ID %d is logging out\n", userID)
-
-	// Logout the user using the Logout method defined on the User struct
-	if err := user.Logout(); err != nil {
+	// Logout the user by revoking the current session
+	err := app.store.RevokeSession(p.UserID, p.SessionID, time.Now())
+	if err != nil && !errors.Is(err, data.ErrSessionNotFound) {
 		fmt.Println("Error logging out:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	app.revocations.forget(p.SessionID)
 
 	// Respond with a success message
 	response := map[string]interface{}{"message": "Logout successful"}
@@ -248,39 +340,12 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // ProfileHandler handles user profile retrieval
-func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Log the start of the handler
 	log.Println("Fetching user profile...")
 
-	// Extract the access token from the Authorization header
-	accessToken := r.Header.Get("Authorization")
-	if accessToken == "" {
-		http.Error(w, "Access token is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if the token starts with the "Bearer " prefix
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		// Remove the "Bearer " prefix from the token
-		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
-	}
-
-	// Check if the access token is expired
-	if isTokenExpired(accessToken) {
-		http.Error(w, "Access token has expired", http.StatusUnauthorized)
-		return
-	}
-
-	// Extract the email associated with the access token
-	email, err := data.GetUserEmailByAccessToken(accessToken)
-	if err != nil {
-		log.Println("Error retrieving user email from access token:", err)
-		http.Error(w, "Error retrieving user email", http.StatusInternalServerError)
-		return
-	}
-
-	// Retrieve the user profile from the database using the email
-	user, err := data.GetUserByEmail(email)
+	// Retrieve the profile of the user authenticated by the middleware
+	user, err := app.store.GetUserByID(principalFrom(r).UserID)
 	if err != nil {
 		log.Println("Error retrieving user profile:", err)
 		http.Error(w, "Error retrieving user profile", http.StatusInternalServerError)
@@ -294,9 +359,9 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log the retrieved user profile
-	log.Println("Retrieved user profile:", user)
+	log.Println("Retrieved user profile for user", user.ID)
 
-	// Respond with the user profile
+	// Respond with the user profile, without the password hash, PIN or refresh token
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(newUserProfile(user))
 }
@@ -0,0 +1,106 @@
+// user_handlers_test.go
+
+package main
+
+import (
+	"backend-project/data"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	app, store := newTestApp(t)
+
+	// Fields users may not choose are ignored
+	w := request(t, app, http.MethodPost, "/register", map[string]interface{}{
+		"email":      "new@example.com",
+		"password":   "secret",
+		"firstName":  "Nina",
+		"lastName":   "New",
+		"IsAdmin":    1,
+		"UserActive": 1,
+		"Role":       data.RoleAdmin,
+	}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	if body["pin"] == nil {
+		t.Error("the PIN was not returned with PIN_IN_RESPONSE set")
+	}
+
+	user, err := store.GetUserByEmail("new@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if user.Role != data.RoleCustomer || user.IsAdmin != 0 {
+		t.Errorf("role = %q, IsAdmin = %d, want a customer", user.Role, user.IsAdmin)
+	}
+	if user.UserActive != 0 {
+		t.Error("the user was created verified")
+	}
+	if user.FirstName != "Nina" || user.LastName != "New" {
+		t.Errorf("name = %q %q, want Nina New", user.FirstName, user.LastName)
+	}
+	if matches, err := user.PasswordMatches("secret"); user.Password == "secret" || err != nil || !matches {
+		t.Error("the password was not stored hashed")
+	}
+
+	// Email addresses are unique whatever their case
+	w = request(t, app, http.MethodPost, "/register", map[string]string{"email": "NEW@example.com", "password": "other"}, "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate registration: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = request(t, app, http.MethodPost, "/register", nil, "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty body: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	// Unverified users cannot log in
+	w := request(t, app, http.MethodPost, "/register", map[string]string{"email": "pending@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("register: status %d", w.Code)
+	}
+	w = request(t, app, http.MethodPost, "/login", map[string]string{"email": "pending@example.com", "password": "secret"}, "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unverified user: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	registerUser(t, app, "user@example.com", "secret")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		status   int
+	}{
+		{"valid credentials", "user@example.com", "secret", http.StatusOK},
+		{"email in another case", "User@Example.com", "secret", http.StatusOK},
+		{"wrong password", "user@example.com", "wrong", http.StatusUnauthorized},
+		{"unknown email", "nobody@example.com", "secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := request(t, app, http.MethodPost, "/login", map[string]string{"email": tt.email, "password": tt.password}, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		body := decode(t, w)
+		accessToken, _ := body["accessToken"].(string)
+		if accessToken == "" || body["refreshToken"] == nil {
+			t.Errorf("%s: tokens missing from %v", tt.name, body)
+			continue
+		}
+		if w := request(t, app, http.MethodGet, "/profile", nil, accessToken); w.Code != http.StatusOK {
+			t.Errorf("%s: profile with the access token: status %d", tt.name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// admin_users.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// User statuses, as filtered on by administrators
+const (
+	// UserStatusUnverified is the status of users who have not verified their
+	// email address yet
+	UserStatusUnverified = "unverified"
+	// UserStatusActive is the status of verified users who may log in
+	UserStatusActive = "active"
+	// UserStatusDeactivated is the status of users an administrator deactivated
+	UserStatusDeactivated = "deactivated"
+)
+
+// Status returns the status of the user
+func (u *User) Status() string {
+	switch {
+	case u.DeactivatedAt != nil:
+		return UserStatusDeactivated
+	case u.UserActive != 1:
+		return UserStatusUnverified
+	default:
+		return UserStatusActive
+	}
+}
+
+// ValidUserStatus reports whether status is one of the known statuses
+func ValidUserStatus(status string) bool {
+	return status == UserStatusUnverified || status == UserStatusActive || status == UserStatusDeactivated
+}
+
+// UserFilter selects a page of users. Empty fields do not filter.
+type UserFilter struct {
+	Search string // Part of the email address or name, case-insensitive
+	Role   string // Role of the users
+	Status string // Status of the users (see UserStatus constants)
+	Limit  int    // Maximum number of users to return
+	Offset int    // Number of matching users to skip
+}
+
+// escapeLike escapes the LIKE wildcards in a search term, for use with ESCAPE '!'
+func escapeLike(term string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(term)
+}
+
+// ListUsers returns the users matching the filter, by ID, and the number of
+// matching users in total
+func (s *SQLStore) ListUsers(filter UserFilter) ([]User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Build the conditions of the filter
+	var conditions []string
+	var args []interface{}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Search)) + "%"
+		conditions = append(conditions, "(LOWER(email) LIKE ? ESCAPE '!' OR LOWER(first_name) LIKE ? ESCAPE '!' OR LOWER(last_name) LIKE ? ESCAPE '!')")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, filter.Role)
+	}
+	switch filter.Status {
+	case UserStatusUnverified:
+		conditions = append(conditions, "deactivated_at IS NULL AND (user_active IS NULL OR user_active <> 1)")
+	case UserStatusActive:
+		conditions = append(conditions, "deactivated_at IS NULL AND user_active = 1")
+	case UserStatusDeactivated:
+		conditions = append(conditions, "deactivated_at IS NOT NULL")
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + userColumns + " FROM users" + where + " ORDER BY id LIMIT ? OFFSET ?"
+	rows, err := s.query(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(userFields(&user)...); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// SetUserDeactivated deactivates a user at the given time, or reactivates
+// them when at is nil
+func (s *SQLStore) SetUserDeactivated(userID int, at *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE users SET deactivated_at = ? WHERE id = ?", at, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser deletes a user with their sessions, PINs, reset tokens,
+// two-factor authentication and failed logins. Their tickets, messages and
+// security events are kept, and tickets assigned to them become unassigned.
+func (s *SQLStore) DeleteUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Start a transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.QueryRowContext(ctx, s.rebind("SELECT email FROM users WHERE id = ?"), userID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	statements := []struct {
+		query string
+		arg   interface{}
+	}{
+		{"DELETE FROM sessions WHERE user_id = ?", userID},
+		{"DELETE FROM verification_pins WHERE user_id = ?", userID},
+		{"DELETE FROM password_resets WHERE user_id = ?", userID},
+		{"DELETE FROM recovery_codes WHERE user_id = ?", userID},
+		{"DELETE FROM two_factor WHERE user_id = ?", userID},
+		{"DELETE FROM login_failures WHERE email = ?", email},
+		{"UPDATE tickets SET assignedTo = NULL WHERE assignedTo = ?", userID},
+		{"DELETE FROM users WHERE id = ?", userID},
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, s.rebind(statement.query), statement.arg); err != nil {
+			return err
+		}
+	}
+
+	// Commit the transaction
+	return tx.Commit()
+}
@@ -0,0 +1,164 @@
+// assignment.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// Automatic ticket assignment strategies
+const (
+	// AssignRoundRobin gives each new ticket to the operator who least recently received one
+	AssignRoundRobin = "round-robin"
+	// AssignLeastOpen gives each new ticket to the operator with the fewest open tickets
+	AssignLeastOpen = "least-open"
+)
+
+// OperatorAvailability records whether an operator can be given new tickets
+type OperatorAvailability struct {
+	UserID           int        `json:"userId"`                     // ID of the operator
+	Available        bool       `json:"available"`                  // Whether the operator is taking new tickets
+	OutOfOfficeUntil *time.Time `json:"outOfOfficeUntil,omitempty"` // The operator is out of office until this time, if set
+}
+
+// OperatorLoad describes an operator who can be given new tickets
+type OperatorLoad struct {
+	UserID         int        // ID of the operator
+	OpenTickets    int        // Number of assigned tickets that are not resolved or closed
+	LastAssignedAt *time.Time // When the operator was last given a ticket automatically
+}
+
+// ValidAssignmentStrategy reports whether strategy is a known assignment strategy
+func ValidAssignmentStrategy(strategy string) bool {
+	return strategy == AssignRoundRobin || strategy == AssignLeastOpen
+}
+
+// ChooseOperator picks the operator a new ticket should be assigned to. It
+// returns false when there is no operator to choose from.
+func ChooseOperator(strategy string, operators []OperatorLoad) (int, bool) {
+	if len(operators) == 0 {
+		return 0, false
+	}
+
+	candidates := append([]OperatorLoad(nil), operators...)
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if strategy == AssignLeastOpen && a.OpenTickets != b.OpenTickets {
+			return a.OpenTickets < b.OpenTickets
+		}
+		// Operators who were never assigned a ticket go first
+		switch {
+		case a.LastAssignedAt == nil && b.LastAssignedAt != nil:
+			return true
+		case a.LastAssignedAt != nil && b.LastAssignedAt == nil:
+			return false
+		case a.LastAssignedAt != nil && !a.LastAssignedAt.Equal(*b.LastAssignedAt):
+			return a.LastAssignedAt.Before(*b.LastAssignedAt)
+		}
+		return a.UserID < b.UserID
+	})
+
+	return candidates[0].UserID, true
+}
+
+// available reports whether the operator is taking new tickets at the given time
+func (a OperatorAvailability) available(now time.Time) bool {
+	return a.Available && (a.OutOfOfficeUntil == nil || !a.OutOfOfficeUntil.After(now))
+}
+
+// GetOperatorAvailability retrieves the availability of an operator
+func (s *SQLStore) GetOperatorAvailability(userID int) (OperatorAvailability, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	availability := OperatorAvailability{UserID: userID}
+	var available int
+	err := s.queryRow(ctx, "SELECT available, out_of_office_until FROM users WHERE id = ?", userID).
+		Scan(&available, &availability.OutOfOfficeUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OperatorAvailability{}, ErrUserNotFound
+		}
+		return OperatorAvailability{}, err
+	}
+	availability.Available = available == 1
+
+	return availability, nil
+}
+
+// SetOperatorAvailability updates the availability of an operator
+func (s *SQLStore) SetOperatorAvailability(availability OperatorAvailability) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	available := 0
+	if availability.Available {
+		available = 1
+	}
+
+	result, err := s.exec(ctx, "UPDATE users SET available = ?, out_of_office_until = ? WHERE id = ?",
+		available, availability.OutOfOfficeUntil, availability.UserID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetAssignableOperators returns the active operators who are available at
+// the given time, with the number of open tickets assigned to each
+func (s *SQLStore) GetAssignableOperators(now time.Time) ([]OperatorLoad, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT u.id, u.out_of_office_until, u.last_assigned_at, COUNT(t.id)
+        FROM users u
+        LEFT JOIN tickets t ON t.assignedTo = u.id AND t.status NOT IN (?, ?)
+        WHERE u.role IN (?, ?, ?) AND u.user_active = 1 AND u.deactivated_at IS NULL AND u.available = 1
+        GROUP BY u.id, u.out_of_office_until, u.last_assigned_at`
+
+	rows, err := s.query(ctx, query, TicketStatusResolved, TicketStatusClosed, RoleAgent, RoleSupervisor, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var operators []OperatorLoad
+	for rows.Next() {
+		var operator OperatorLoad
+		var outOfOfficeUntil *time.Time
+		if err := rows.Scan(&operator.UserID, &outOfOfficeUntil, &operator.LastAssignedAt, &operator.OpenTickets); err != nil {
+			return nil, err
+		}
+		// Out-of-office times are compared here rather than in SQL, as the
+		// dialects store timestamps differently
+		if outOfOfficeUntil != nil && outOfOfficeUntil.After(now) {
+			continue
+		}
+		operators = append(operators, operator)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return operators, nil
+}
+
+// RecordTicketAssignment records when an operator was last given a ticket automatically
+func (s *SQLStore) RecordTicketAssignment(userID int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "UPDATE users SET last_assigned_at = ? WHERE id = ?", at, userID)
+	return err
+}
@@ -0,0 +1,80 @@
+// login_failures.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GetLoginFailures retrieves the failed logins with an email address. An
+// address without failed logins has zero attempts.
+func (s *SQLStore) GetLoginFailures(email string) (*LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT email, failed_attempts, last_failed_at, locked_until
+        FROM login_failures
+        WHERE email = ?`
+
+	var failures LoginFailures
+	err := s.queryRow(ctx, query, email).Scan(
+		&failures.Email,
+		&failures.FailedAttempts,
+		&failures.LastFailedAt,
+		&failures.LockedUntil,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &LoginFailures{Email: email}, nil
+		}
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// RecordLoginFailure counts a failed login with an email address and returns
+// the number of failed logins since the last successful one
+func (s *SQLStore) RecordLoginFailure(email string, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Insert or increment in one statement, so that concurrent failures are
+	// all counted, including the first ones for an address
+	stmt := `
+        INSERT INTO login_failures (email, failed_attempts, last_failed_at)
+        VALUES (?, 1, ?)
+        ` + s.dialect.upsertClause("email") + `
+        failed_attempts = login_failures.failed_attempts + 1, last_failed_at = ?`
+
+	if _, err := s.exec(ctx, stmt, email, at, at); err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	if err := s.queryRow(ctx, "SELECT failed_attempts FROM login_failures WHERE email = ?", email).Scan(&attempts); err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// LockLogin refuses logins with an email address until the given time
+func (s *SQLStore) LockLogin(email string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "UPDATE login_failures SET locked_until = ? WHERE email = ?", until, email)
+	return err
+}
+
+// ClearLoginFailures forgets the failed logins with an email address, which
+// also lifts a lock
+func (s *SQLStore) ClearLoginFailures(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "DELETE FROM login_failures WHERE email = ?", email)
+	return err
+}
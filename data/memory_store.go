@@ -0,0 +1,1065 @@
+// memory_store.go
+package data
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryRecoveryCode is the in-memory equivalent of a row of recovery_codes
+type memoryRecoveryCode struct {
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+// memoryOperator is the in-memory equivalent of the availability columns in users
+type memoryOperator struct {
+	OperatorAvailability
+	LastAssignedAt *time.Time
+}
+
+// MemoryStore implements Store in process memory. It is safe for concurrent
+// use and is meant for tests, demos and local development; everything is
+// lost when the process exits.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users         map[int]*User
+	sessions      map[int64]*Session
+	events        []SecurityEvent
+	resets        []*PasswordReset
+	pins          map[int64]*VerificationPin
+	twoFactors    map[int]*TwoFactor           // keyed by user ID
+	recoveryCodes map[int][]memoryRecoveryCode // keyed by user ID
+	loginFailures map[string]*LoginFailures    // keyed by lower case email
+	tickets       map[int64]*Ticket
+	conversations map[int64]*Conversation
+	operators     map[int]*memoryOperator // keyed by user ID, created on first use
+	pendingEmails map[int]string          // keyed by user ID
+
+	nextUserID         int
+	nextSessionID      int64
+	nextPinID          int64
+	nextTicketID       int64
+	nextConversationID int64
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[int]*User),
+		sessions:      make(map[int64]*Session),
+		pins:          make(map[int64]*VerificationPin),
+		twoFactors:    make(map[int]*TwoFactor),
+		recoveryCodes: make(map[int][]memoryRecoveryCode),
+		loginFailures: make(map[string]*LoginFailures),
+		tickets:       make(map[int64]*Ticket),
+		conversations: make(map[int64]*Conversation),
+		operators:     make(map[int]*memoryOperator),
+		pendingEmails: make(map[int]string),
+	}
+}
+
+// CreateUser stores a new user and returns its ID
+func (m *MemoryStore) CreateUser(u *User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Email addresses are unique, as enforced by the registration handler
+	if m.findUserByEmail(u.Email) != nil {
+		return 0, errors.New("duplicate email address")
+	}
+
+	m.nextUserID++
+	user := *u
+	user.ID = m.nextUserID
+	user.IsAdmin = isAdminFlag(u.Role)
+	m.users[user.ID] = &user
+
+	return user.ID, nil
+}
+
+// findUserByEmail returns the stored user with the given email, or nil. Like
+// the SQL stores, it compares email addresses case-insensitively. The caller
+// must hold the lock.
+func (m *MemoryStore) findUserByEmail(email string) *User {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+// userRow returns a copy of the stored user holding the same fields the SQL store selects
+func userRow(u *User) *User {
+	found := *u
+	found.PinNumber = ""
+	found.RefreshJWT = ""
+	return &found
+}
+
+// GetUserByEmail retrieves a user by email
+func (m *MemoryStore) GetUserByEmail(email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user := m.findUserByEmail(email)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return userRow(user), nil
+}
+
+// GetUserByID retrieves a user by ID
+func (m *MemoryStore) GetUserByID(userID int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return userRow(user), nil
+}
+
+// GetUserEmailByID retrieves the email associated with the provided user ID
+func (m *MemoryStore) GetUserEmailByID(userID int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return "", nil
+	}
+	return user.Email, nil
+}
+
+// UserExists checks if a user already exists by email
+func (m *MemoryStore) UserExists(email string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findUserByEmail(email) != nil, nil
+}
+
+// ActivateAccount activates the user account by setting UserActive to 1
+func (m *MemoryStore) ActivateAccount(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.UserActive = 1
+	}
+	return nil
+}
+
+// UpdatePinAfterVerification marks the PIN as used and activates the user account
+func (m *MemoryStore) UpdatePinAfterVerification(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return errors.New("no rows affected, user not found or pin update failed")
+	}
+
+	user.PinNumber = PinVerified
+	user.UserActive = 1
+	return nil
+}
+
+// UpdatePassword replaces the password hash of a user
+func (m *MemoryStore) UpdatePassword(userID int, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Password = passwordHash
+	return nil
+}
+
+// UpdateUserName replaces the first and last name of a user
+func (m *MemoryStore) UpdateUserName(userID int, firstName, lastName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.FirstName = firstName
+	user.LastName = lastName
+	return nil
+}
+
+// SetUserRole changes the role of a user, and is_admin with it
+func (m *MemoryStore) SetUserRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	user.IsAdmin = isAdminFlag(role)
+	return nil
+}
+
+// ListUsers returns the users matching the filter, by ID
+func (m *MemoryStore) ListUsers(filter UserFilter) ([]User, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+	var matching []User
+	for _, user := range m.users {
+		if search != "" && !strings.Contains(strings.ToLower(user.Email), search) &&
+			!strings.Contains(strings.ToLower(user.FirstName), search) &&
+			!strings.Contains(strings.ToLower(user.LastName), search) {
+			continue
+		}
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Status != "" && user.Status() != filter.Status {
+			continue
+		}
+		matching = append(matching, *userRow(user))
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].ID < matching[j].ID })
+
+	users := []User{}
+	for i := filter.Offset; i < len(matching) && len(users) < filter.Limit; i++ {
+		users = append(users, matching[i])
+	}
+	return users, len(matching), nil
+}
+
+// SetUserDeactivated deactivates a user at the given time, or reactivates them when at is nil
+func (m *MemoryStore) SetUserDeactivated(userID int, at *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.DeactivatedAt = at
+	return nil
+}
+
+// DeleteUser deletes a user and the data only they use, keeping their tickets
+func (m *MemoryStore) DeleteUser(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	for id, pin := range m.pins {
+		if pin.UserID == userID {
+			delete(m.pins, id)
+		}
+	}
+	var resets []*PasswordReset
+	for _, reset := range m.resets {
+		if reset.UserID != userID {
+			resets = append(resets, reset)
+		}
+	}
+	m.resets = resets
+	delete(m.twoFactors, userID)
+	delete(m.recoveryCodes, userID)
+	delete(m.loginFailures, strings.ToLower(user.Email))
+	delete(m.pendingEmails, userID)
+	delete(m.operators, userID)
+	for _, ticket := range m.tickets {
+		if ticket.AssignedTo != nil && *ticket.AssignedTo == int64(userID) {
+			ticket.AssignedTo = nil
+		}
+	}
+	delete(m.users, userID)
+	return nil
+}
+
+// SetPendingEmail records the email address a user wants to change to
+func (m *MemoryStore) SetPendingEmail(userID int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return ErrUserNotFound
+	}
+	m.pendingEmails[userID] = email
+	return nil
+}
+
+// GetPendingEmail retrieves the email address a user wants to change to
+func (m *MemoryStore) GetPendingEmail(userID int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return "", ErrUserNotFound
+	}
+	pending, ok := m.pendingEmails[userID]
+	if !ok || pending == "" {
+		return "", ErrNoPendingEmail
+	}
+	return pending, nil
+}
+
+// ConfirmPendingEmail makes the pending email address of a user their email address
+func (m *MemoryStore) ConfirmPendingEmail(userID int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	pending, pendingOK := m.pendingEmails[userID]
+	if !ok || !pendingOK || pending != email {
+		return ErrNoPendingEmail
+	}
+	// Email addresses are unique, as the unique index enforces in SQL
+	if other := m.findUserByEmail(email); other != nil && other.ID != userID {
+		return errors.New("duplicate email address")
+	}
+	user.Email = email
+	delete(m.pendingEmails, userID)
+	return nil
+}
+
+// CreatePasswordReset stores a new password reset token and returns its ID
+func (m *MemoryStore) CreatePasswordReset(reset *PasswordReset) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *reset
+	stored.ID = int64(len(m.resets) + 1)
+	stored.UsedAt = nil
+	m.resets = append(m.resets, &stored)
+
+	return stored.ID, nil
+}
+
+// GetPasswordReset retrieves a password reset token by the hash of the token
+func (m *MemoryStore) GetPasswordReset(tokenHash string) (*PasswordReset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, reset := range m.resets {
+		if reset.TokenHash == tokenHash {
+			copied := *reset
+			return &copied, nil
+		}
+	}
+	return nil, ErrPasswordResetNotFound
+}
+
+// UsePasswordResets marks every unused password reset token of a user as used
+func (m *MemoryStore) UsePasswordResets(userID int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used := false
+	for _, reset := range m.resets {
+		if reset.UserID == userID && reset.UsedAt == nil {
+			usedAt := at
+			reset.UsedAt = &usedAt
+			used = true
+		}
+	}
+	if !used {
+		return ErrPasswordResetNotFound
+	}
+	return nil
+}
+
+// ReplaceVerificationPin stores a new verification PIN, replacing the PIN the
+// user had for the same purpose, and returns its ID
+func (m *MemoryStore) ReplaceVerificationPin(pin *VerificationPin) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, existing := range m.pins {
+		if existing.UserID == pin.UserID && existing.Purpose == pin.Purpose {
+			delete(m.pins, id)
+		}
+	}
+
+	m.nextPinID++
+	stored := *pin
+	stored.ID = m.nextPinID
+	m.pins[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+// GetVerificationPin retrieves the PIN of a user for the given purpose
+func (m *MemoryStore) GetVerificationPin(userID int, purpose string) (*VerificationPin, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, pin := range m.pins {
+		if pin.UserID == userID && pin.Purpose == purpose {
+			found := *pin
+			return &found, nil
+		}
+	}
+	return nil, ErrVerificationPinNotFound
+}
+
+// RecordPinAttempt counts an attempt at entering a PIN, up to maxAttempts
+func (m *MemoryStore) RecordPinAttempt(pinID int64, maxAttempts int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pin, ok := m.pins[pinID]
+	if !ok || pin.Attempts >= maxAttempts {
+		return ErrPinAttemptsExceeded
+	}
+	pin.Attempts++
+	return nil
+}
+
+// DeleteVerificationPin deletes the PIN of a user for the given purpose
+func (m *MemoryStore) DeleteVerificationPin(userID int, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, pin := range m.pins {
+		if pin.UserID == userID && pin.Purpose == purpose {
+			delete(m.pins, id)
+		}
+	}
+	return nil
+}
+
+// CreateTwoFactor stores a pending authenticator for a user, replacing any earlier pending one
+func (m *MemoryStore) CreateTwoFactor(twoFactor *TwoFactor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.twoFactors[twoFactor.UserID]; ok && existing.Enabled() {
+		return errors.New("two-factor authentication already enabled")
+	}
+	stored := *twoFactor
+	stored.EnabledAt = nil
+	stored.LastUsedStep = 0
+	stored.FailedAttempts = 0
+	stored.LastFailedAt = nil
+	m.twoFactors[twoFactor.UserID] = &stored
+	return nil
+}
+
+// GetTwoFactor retrieves the authenticator of a user, pending or enabled
+func (m *MemoryStore) GetTwoFactor(userID int) (*TwoFactor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	twoFactor, ok := m.twoFactors[userID]
+	if !ok {
+		return nil, ErrTwoFactorNotFound
+	}
+	found := *twoFactor
+	return &found, nil
+}
+
+// EnableTwoFactor confirms the pending authenticator of a user and stores their recovery codes
+func (m *MemoryStore) EnableTwoFactor(userID int, step int64, codeHashes []string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	twoFactor, ok := m.twoFactors[userID]
+	if !ok || twoFactor.Enabled() {
+		return ErrTwoFactorNotFound
+	}
+	enabledAt := at
+	twoFactor.EnabledAt = &enabledAt
+	twoFactor.LastUsedStep = step
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// UseTotpStep records that the code of a time step was accepted
+func (m *MemoryStore) UseTotpStep(userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	twoFactor, ok := m.twoFactors[userID]
+	if !ok || twoFactor.LastUsedStep >= step {
+		return ErrTotpCodeReused
+	}
+	twoFactor.LastUsedStep = step
+	twoFactor.FailedAttempts = 0
+	twoFactor.LastFailedAt = nil
+	return nil
+}
+
+// RecordTwoFactorAttempt counts an attempt at entering a code, unless maxAttempts were already counted
+func (m *MemoryStore) RecordTwoFactorAttempt(userID, maxAttempts int, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	twoFactor, ok := m.twoFactors[userID]
+	if !ok || twoFactor.FailedAttempts >= maxAttempts {
+		return 0, ErrTwoFactorAttemptsExceeded
+	}
+	attemptedAt := at
+	twoFactor.FailedAttempts++
+	twoFactor.LastFailedAt = &attemptedAt
+	return twoFactor.FailedAttempts, nil
+}
+
+// ResetTwoFactorAttempts clears the counted attempts while the count is still the one seen
+func (m *MemoryStore) ResetTwoFactorAttempts(userID, seenAttempts int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if twoFactor, ok := m.twoFactors[userID]; ok && twoFactor.FailedAttempts == seenAttempts {
+		twoFactor.FailedAttempts = 0
+		twoFactor.LastFailedAt = nil
+	}
+	return nil
+}
+
+// DeleteTwoFactor removes the authenticator and recovery codes of a user
+func (m *MemoryStore) DeleteTwoFactor(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.twoFactors[userID]; !ok {
+		return ErrTwoFactorNotFound
+	}
+	delete(m.twoFactors, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user with the given hashes
+func (m *MemoryStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes replaces the recovery codes of a user; the caller holds the lock
+func (m *MemoryStore) replaceRecoveryCodes(userID int, codeHashes []string) {
+	codes := make([]memoryRecoveryCode, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes = append(codes, memoryRecoveryCode{CodeHash: codeHash})
+	}
+	m.recoveryCodes[userID] = codes
+}
+
+// UseRecoveryCode marks a recovery code of a user as used
+func (m *MemoryStore) UseRecoveryCode(userID int, codeHash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := m.recoveryCodes[userID]
+	for i := range codes {
+		if codes[i].CodeHash == codeHash && codes[i].UsedAt == nil {
+			usedAt := at
+			codes[i].UsedAt = &usedAt
+			if twoFactor, ok := m.twoFactors[userID]; ok {
+				twoFactor.FailedAttempts = 0
+				twoFactor.LastFailedAt = nil
+			}
+			return nil
+		}
+	}
+	return ErrRecoveryCodeNotFound
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (m *MemoryStore) CountRecoveryCodes(userID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, code := range m.recoveryCodes[userID] {
+		if code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetLoginFailures retrieves the failed logins with an email address
+func (m *MemoryStore) GetLoginFailures(email string) (*LoginFailures, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	failures, ok := m.loginFailures[strings.ToLower(email)]
+	if !ok {
+		return &LoginFailures{Email: email}, nil
+	}
+	found := *failures
+	return &found, nil
+}
+
+// RecordLoginFailure counts a failed login with an email address
+func (m *MemoryStore) RecordLoginFailure(email string, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failures, ok := m.loginFailures[strings.ToLower(email)]
+	if !ok {
+		failures = &LoginFailures{Email: email}
+		m.loginFailures[strings.ToLower(email)] = failures
+	}
+	failedAt := at
+	failures.FailedAttempts++
+	failures.LastFailedAt = &failedAt
+	return failures.FailedAttempts, nil
+}
+
+// LockLogin refuses logins with an email address until the given time
+func (m *MemoryStore) LockLogin(email string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if failures, ok := m.loginFailures[strings.ToLower(email)]; ok {
+		lockedUntil := until
+		failures.LockedUntil = &lockedUntil
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failed logins with an email address
+func (m *MemoryStore) ClearLoginFailures(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginFailures, strings.ToLower(email))
+	return nil
+}
+
+// CreateSession stores a new session and returns its ID
+func (m *MemoryStore) CreateSession(session *Session) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextSessionID++
+	stored := *session
+	stored.ID = m.nextSessionID
+	stored.RevokedAt = nil
+	m.sessions[stored.ID] = &stored
+
+	return stored.ID, nil
+}
+
+// GetSession retrieves a session by ID, whether or not it is still active
+func (m *MemoryStore) GetSession(sessionID int64) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// GetSessionsByUserID returns the sessions of a user that are active at the
+// given time, most recently used first
+func (m *MemoryStore) GetSessionsByUserID(userID int, now time.Time) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+// TouchSession records that a session was used at the given time
+func (m *MemoryStore) TouchSession(sessionID int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[sessionID]; ok {
+		session.LastSeenAt = at
+	}
+	return nil
+}
+
+// RotateRefreshToken replaces the current refresh token of an active session
+// and records the session as used
+func (m *MemoryStore) RotateRefreshToken(sessionID int64, from, to string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok || session.RefreshTokenID != from || session.RevokedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	session.RefreshTokenID = to
+	session.LastSeenAt = at
+	return nil
+}
+
+// RecordSecurityEvent stores a security event and returns its ID
+func (m *MemoryStore) RecordSecurityEvent(event *SecurityEvent) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *event
+	stored.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, stored)
+
+	return stored.ID, nil
+}
+
+// RevokeSession revokes one session of a user
+func (m *MemoryStore) RevokeSession(userID int, sessionID int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	revokedAt := at
+	session.RevokedAt = &revokedAt
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of a user except keepSessionID
+// and returns how many were revoked
+func (m *MemoryStore) RevokeOtherSessions(userID int, keepSessionID int64, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revoked := 0
+	for _, session := range m.sessions {
+		if session.UserID != userID || session.ID == keepSessionID || session.RevokedAt != nil {
+			continue
+		}
+		revokedAt := at
+		session.RevokedAt = &revokedAt
+		revoked++
+	}
+	return revoked, nil
+}
+
+// CreateTicket creates a new ticket with its initial operator message and returns its ID
+func (m *MemoryStore) CreateTicket(userID int, subject, issue, priority string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var email string
+	if user, ok := m.users[userID]; ok {
+		email = user.Email
+	}
+
+	now := time.Now()
+	m.nextTicketID++
+	ticket := &Ticket{
+		ID:         m.nextTicketID,
+		UserID:     int64(userID),
+		Email:      email,
+		Subject:    subject,
+		Issue:      issue,
+		Status:     TicketStatusNew,
+		Priority:   priority,
+		DateOpened: now,
+	}
+	m.tickets[ticket.ID] = ticket
+
+	m.addConversation(ticket.ID, 0, "operator", InitialConversationMessage, now)
+
+	return int(ticket.ID), nil
+}
+
+// addConversation stores a conversation message and returns its ID. The caller must hold the lock.
+func (m *MemoryStore) addConversation(ticketID int64, senderID int64, sender, message string, sentAt time.Time) int64 {
+	m.nextConversationID++
+	conv := &Conversation{
+		ID:            m.nextConversationID,
+		TicketID:      ticketID,
+		Sender:        sender,
+		Message:       message,
+		MessageSentAt: sentAt,
+	}
+	if senderID != 0 {
+		conv.SenderID = &senderID
+	}
+	m.conversations[conv.ID] = conv
+	return m.nextConversationID
+}
+
+// sortedTickets returns copies of the tickets accepted by keep, ordered by ID. The caller must hold the lock.
+func (m *MemoryStore) sortedTickets(keep func(*Ticket) bool) []Ticket {
+	var tickets []Ticket
+	for _, ticket := range m.tickets {
+		if keep(ticket) {
+			tickets = append(tickets, *ticket)
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].ID < tickets[j].ID })
+	return tickets
+}
+
+// GetTickets retrieves all tickets, most urgent and oldest first
+func (m *MemoryStore) GetTickets() ([]Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tickets := m.sortedTickets(func(*Ticket) bool { return true })
+	sortTicketQueue(tickets)
+	return tickets, nil
+}
+
+// GetTicketsByUserID retrieves all tickets for a given user ID
+func (m *MemoryStore) GetTicketsByUserID(userID int64) ([]Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sortedTickets(func(t *Ticket) bool { return t.UserID == userID }), nil
+}
+
+// GetTicketByID retrieves a ticket by its ID
+func (m *MemoryStore) GetTicketByID(ticketID int64) (Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return *ticket, nil
+}
+
+// GetUserIDByTicketID retrieves the user ID associated with a ticket
+func (m *MemoryStore) GetUserIDByTicketID(ticketID int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return 0, ErrTicketNotFound
+	}
+	return ticket.UserID, nil
+}
+
+// UpdateTicketStatus moves a ticket from one status to another, recording
+// when and by whom it was closed
+func (m *MemoryStore) UpdateTicketStatus(ticketID int64, from, to string, changedBy int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return ErrTicketNotFound
+	}
+	if ticket.Status != from {
+		return ErrTicketStatusChanged
+	}
+
+	ticket.Status = to
+	ticket.ClosedAt = nil
+	ticket.ClosedBy = nil
+	if to == TicketStatusClosed {
+		now := time.Now()
+		ticket.ClosedAt = &now
+		ticket.ClosedBy = &changedBy
+	}
+	return nil
+}
+
+// GetTicketsByAssignee retrieves the tickets assigned to an operator, most urgent and
+// oldest first. An assigneeID of 0 returns the unassigned tickets.
+func (m *MemoryStore) GetTicketsByAssignee(assigneeID int64) ([]Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tickets := m.sortedTickets(func(t *Ticket) bool {
+		if assigneeID == 0 {
+			return t.AssignedTo == nil
+		}
+		return t.AssignedTo != nil && *t.AssignedTo == assigneeID
+	})
+	sortTicketQueue(tickets)
+	return tickets, nil
+}
+
+// AssignTicket moves a ticket from one assignee to another, where 0 means unassigned
+func (m *MemoryStore) AssignTicket(ticketID int64, from, to int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return ErrTicketNotFound
+	}
+
+	var current int64
+	if ticket.AssignedTo != nil {
+		current = *ticket.AssignedTo
+	}
+	if current != from {
+		return ErrTicketAssigneeChanged
+	}
+
+	ticket.AssignedTo = nil
+	if to != 0 {
+		ticket.AssignedTo = &to
+	}
+	return nil
+}
+
+// UpdateTicketPriority sets the priority and severity of a ticket. An empty severity clears it.
+func (m *MemoryStore) UpdateTicketPriority(ticketID int64, priority, severity string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, ok := m.tickets[ticketID]
+	if !ok {
+		return ErrTicketNotFound
+	}
+
+	ticket.Priority = priority
+	ticket.Severity = nil
+	if severity != "" {
+		ticket.Severity = &severity
+	}
+	return nil
+}
+
+// PurgeTicket permanently deletes a ticket together with its conversations
+func (m *MemoryStore) PurgeTicket(ticketID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tickets[ticketID]; !ok {
+		return ErrTicketNotFound
+	}
+
+	for id, conv := range m.conversations {
+		if conv.TicketID == ticketID {
+			delete(m.conversations, id)
+		}
+	}
+	delete(m.tickets, ticketID)
+
+	return nil
+}
+
+// AddConversation adds a conversation message to a ticket
+func (m *MemoryStore) AddConversation(ticketID int64, senderID int64, sender, message string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addConversation(ticketID, senderID, sender, message, time.Now()), nil
+}
+
+// GetConversationsByTicketID retrieves all conversations associated with a ticket ID, oldest first
+func (m *MemoryStore) GetConversationsByTicketID(ticketID int64) ([]Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var conversations []Conversation
+	for _, conv := range m.conversations {
+		if conv.TicketID == ticketID {
+			conversations = append(conversations, *conv)
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool { return conversations[i].ID < conversations[j].ID })
+
+	return conversations, nil
+}
+
+// operator returns the availability record of a user, creating it on first use. The caller must hold the lock.
+func (m *MemoryStore) operator(userID int) *memoryOperator {
+	operator, ok := m.operators[userID]
+	if !ok {
+		operator = &memoryOperator{OperatorAvailability: OperatorAvailability{UserID: userID, Available: true}}
+		m.operators[userID] = operator
+	}
+	return operator
+}
+
+// GetOperatorAvailability retrieves the availability of an operator
+func (m *MemoryStore) GetOperatorAvailability(userID int) (OperatorAvailability, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return OperatorAvailability{}, ErrUserNotFound
+	}
+	return m.operator(userID).OperatorAvailability, nil
+}
+
+// SetOperatorAvailability updates the availability of an operator
+func (m *MemoryStore) SetOperatorAvailability(availability OperatorAvailability) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[availability.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	m.operator(availability.UserID).OperatorAvailability = availability
+	return nil
+}
+
+// GetAssignableOperators returns the active operators who are available at
+// the given time, with the number of open tickets assigned to each
+func (m *MemoryStore) GetAssignableOperators(now time.Time) ([]OperatorLoad, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var operators []OperatorLoad
+	for _, user := range m.users {
+		operator := m.operator(user.ID)
+		if !StaffRole(user.Role) || user.Status() != UserStatusActive || !operator.available(now) {
+			continue
+		}
+
+		load := OperatorLoad{UserID: user.ID, LastAssignedAt: operator.LastAssignedAt}
+		for _, ticket := range m.tickets {
+			if ticket.AssignedTo != nil && *ticket.AssignedTo == int64(user.ID) &&
+				ticket.Status != TicketStatusResolved && ticket.Status != TicketStatusClosed {
+				load.OpenTickets++
+			}
+		}
+		operators = append(operators, load)
+	}
+	return operators, nil
+}
+
+// RecordTicketAssignment records when an operator was last given a ticket automatically
+func (m *MemoryStore) RecordTicketAssignment(userID int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.operator(userID).LastAssignedAt = &at
+	return nil
+}
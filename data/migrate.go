@@ -0,0 +1,310 @@
+// migrate.go
+package data
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the versioned schema migrations for every SQL dialect.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationTimeout bounds how long a single migration may run
+const migrationTimeout = 5 * time.Minute
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator is implemented by stores whose schema is managed with migrations
+type Migrator interface {
+	MigrateUp() (int, error)
+	MigrateDown(steps int) (int, error)
+	MigrationStatus() ([]MigrationState, error)
+	PendingMigrations() (int, error)
+}
+
+// loadMigrations reads the embedded migrations for a dialect, ordered by version
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dir))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		// Split "0001_initial_schema.up.sql" into version, name and direction
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionPart, migrationName, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no name", name)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", name, err)
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join("migrations", dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// splitStatements splits a migration script into individual statements.
+// Statements end with a semicolon at the end of a line; -- comments are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// ensureMigrationsTable creates the schema_migrations table if it does not exist yet
+func (s *SQLStore) ensureMigrationsTable(ctx context.Context) error {
+	_, err := s.exec(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version BIGINT NOT NULL PRIMARY KEY,
+            name VARCHAR(255) NOT NULL,
+            applied_at TIMESTAMP NULL
+        )`)
+	return err
+}
+
+// appliedMigrations returns the applied migration versions and when they were applied
+func (s *SQLStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	rows, err := s.query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// runMigration executes one direction of a migration and records the result in schema_migrations
+func (s *SQLStore) runMigration(m Migration, up bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+
+	// Run the statements in a transaction. MySQL commits DDL implicitly, so a
+	// failed MySQL migration may need to be repaired by hand.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, s.rebind("DELETE FROM schema_migrations WHERE version = ?"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies every pending migration in order and returns how many were applied
+func (s *SQLStore) MigrateUp() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := s.runMigration(m, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations and returns how many were rolled back
+func (s *SQLStore) MigrateDown(steps int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s cannot be rolled back", m.Version, m.Name)
+		}
+		if err := s.runMigration(m, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (s *SQLStore) MigrationStatus() ([]MigrationState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if appliedAt, ok := applied[m.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// PendingMigrations returns the number of migrations that have not been applied yet
+func (s *SQLStore) PendingMigrations() (int, error) {
+	states, err := s.MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,51 @@
+-- Initial schema. Tables are only created when missing, so databases set up
+-- from the old deployment guide are adopted as version 1 as they are.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `email` varchar(255) NOT NULL,
+  `first_name` varchar(255) DEFAULT NULL,
+  `last_name` varchar(255) DEFAULT NULL,
+  `password` varchar(255) NOT NULL,
+  `pin_number` varchar(255) DEFAULT NULL,
+  `user_active` int(11) DEFAULT NULL,
+  `is_admin` int(11) DEFAULT NULL,
+  `refreshJWT` text DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `users_email` (`email`)
+);
+
+CREATE TABLE IF NOT EXISTS `access_tokens` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED DEFAULT NULL,
+  `email` varchar(255) NOT NULL,
+  `accessJWT` varchar(512) NOT NULL,
+  `created_at` timestamp NULL DEFAULT current_timestamp(),
+  `updated_at` timestamp NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  `expires_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `access_tokens_user_id` (`user_id`),
+  KEY `access_tokens_access_jwt` (`accessJWT`)
+);
+
+CREATE TABLE IF NOT EXISTS `tickets` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `userId` bigint(20) UNSIGNED NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `issue` varchar(255) DEFAULT NULL,
+  `status` varchar(50) NOT NULL,
+  `dateOpened` timestamp NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  KEY `tickets_user_id` (`userId`)
+);
+
+CREATE TABLE IF NOT EXISTS `conversations` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `ticketId` int(11) NOT NULL,
+  `sender` varchar(255) NOT NULL,
+  `message` text NOT NULL,
+  `messageSentAt` timestamp NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`id`),
+  KEY `conversations_ticket_id` (`ticketId`)
+);
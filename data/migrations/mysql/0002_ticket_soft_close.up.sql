@@ -0,0 +1,5 @@
+-- Closing a ticket keeps it and records when and by whom it was closed.
+
+ALTER TABLE `tickets`
+  ADD COLUMN `closedAt` timestamp NULL DEFAULT NULL,
+  ADD COLUMN `closedBy` bigint(20) UNSIGNED DEFAULT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE `tickets`
+  DROP KEY `tickets_priority`,
+  DROP COLUMN `priority`,
+  DROP COLUMN `severity`;
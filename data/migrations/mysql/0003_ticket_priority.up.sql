@@ -0,0 +1,7 @@
+-- Tickets carry a priority and an optional severity; the admin queue is
+-- ordered by priority and then by age.
+
+ALTER TABLE `tickets`
+  ADD COLUMN `priority` varchar(20) NOT NULL DEFAULT 'normal',
+  ADD COLUMN `severity` varchar(20) DEFAULT NULL,
+  ADD KEY `tickets_priority` (`priority`, `dateOpened`);
@@ -0,0 +1,6 @@
+ALTER TABLE `conversations`
+  DROP COLUMN `senderId`;
+
+ALTER TABLE `tickets`
+  DROP KEY `tickets_assigned_to`,
+  DROP COLUMN `assignedTo`;
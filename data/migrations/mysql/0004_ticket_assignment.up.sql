@@ -0,0 +1,9 @@
+-- Tickets can be assigned to an operator, and every message records the
+-- ID of the user who sent it.
+
+ALTER TABLE `tickets`
+  ADD COLUMN `assignedTo` bigint(20) UNSIGNED DEFAULT NULL,
+  ADD KEY `tickets_assigned_to` (`assignedTo`);
+
+ALTER TABLE `conversations`
+  ADD COLUMN `senderId` bigint(20) UNSIGNED DEFAULT NULL;
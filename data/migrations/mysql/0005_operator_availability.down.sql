@@ -0,0 +1,4 @@
+ALTER TABLE `users`
+  DROP COLUMN `available`,
+  DROP COLUMN `out_of_office_until`,
+  DROP COLUMN `last_assigned_at`;
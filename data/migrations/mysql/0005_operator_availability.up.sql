@@ -0,0 +1,7 @@
+-- Operators can mark themselves unavailable or out of office, and the time
+-- each operator was last given a ticket drives round-robin assignment.
+
+ALTER TABLE `users`
+  ADD COLUMN `available` int(11) NOT NULL DEFAULT 1,
+  ADD COLUMN `out_of_office_until` timestamp NULL DEFAULT NULL,
+  ADD COLUMN `last_assigned_at` timestamp NULL DEFAULT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `access_tokens` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED DEFAULT NULL,
+  `email` varchar(255) NOT NULL,
+  `accessJWT` varchar(512) NOT NULL,
+  `created_at` timestamp NULL DEFAULT current_timestamp(),
+  `updated_at` timestamp NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  `expires_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `access_tokens_user_id` (`user_id`),
+  KEY `access_tokens_access_jwt` (`accessJWT`)
+);
+
+DROP TABLE IF EXISTS `sessions`;
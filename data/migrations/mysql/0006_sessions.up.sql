@@ -0,0 +1,18 @@
+-- Each login creates a session, so a user can be signed in on several
+-- devices at once and revoke them one by one. Sessions replace the single
+-- access token row per user.
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `ip_address` varchar(45) NOT NULL DEFAULT '',
+  `created_at` timestamp NULL DEFAULT NULL,
+  `last_seen_at` timestamp NULL DEFAULT NULL,
+  `expires_at` timestamp NULL DEFAULT NULL,
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `sessions_user_id` (`user_id`)
+);
+
+DROP TABLE IF EXISTS `access_tokens`;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `security_events`;
+
+ALTER TABLE `sessions`
+  DROP COLUMN `refresh_token_id`;
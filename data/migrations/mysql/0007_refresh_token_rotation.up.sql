@@ -0,0 +1,19 @@
+-- Refresh tokens are rotated on every use. Each session stores the ID of
+-- its current refresh token; presenting an older one revokes the session and
+-- is recorded as a security event.
+
+ALTER TABLE `sessions`
+  ADD COLUMN `refresh_token_id` varchar(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `security_events` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `session_id` bigint(20) UNSIGNED DEFAULT NULL,
+  `event_type` varchar(50) NOT NULL,
+  `ip_address` varchar(45) NOT NULL DEFAULT '',
+  `user_agent` varchar(255) NOT NULL DEFAULT '',
+  `details` varchar(255) NOT NULL DEFAULT '',
+  `created_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `security_events_user_id` (`user_id`)
+);
@@ -0,0 +1,14 @@
+-- Password reset tokens emailed by POST /password/forgot. Only a hash of each
+-- token is stored; a token can be used once, before it expires.
+
+CREATE TABLE IF NOT EXISTS `password_resets` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `token_hash` varchar(64) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `expires_at` timestamp NULL DEFAULT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `password_resets_token_hash` (`token_hash`),
+  KEY `password_resets_user_id` (`user_id`)
+);
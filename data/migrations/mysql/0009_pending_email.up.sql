@@ -0,0 +1,6 @@
+-- A new email address only replaces the current one once the user enters
+-- the PIN sent to it.
+
+ALTER TABLE `users`
+  ADD COLUMN `pending_email` varchar(255) DEFAULT NULL,
+  ADD COLUMN `pending_email_pin` varchar(255) DEFAULT NULL;
@@ -0,0 +1,19 @@
+-- PINs emailed to verify an account or a new email address. Only a hash of
+-- each PIN is stored; a PIN expires and only accepts a few attempts.
+-- Plain-text PINs of unverified accounts are cleared; they can ask for a new one.
+
+CREATE TABLE IF NOT EXISTS `verification_pins` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `purpose` varchar(32) NOT NULL,
+  `pin_hash` varchar(255) NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `expires_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `verification_pins_user_id_purpose` (`user_id`, `purpose`)
+);
+
+UPDATE `users` SET `pin_number` = NULL WHERE `pin_number` <> 'N/A - verified';
+
+ALTER TABLE `users` DROP COLUMN `pending_email_pin`;
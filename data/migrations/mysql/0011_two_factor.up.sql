@@ -0,0 +1,24 @@
+-- TOTP two-factor authentication. Recovery codes are stored as hashes and
+-- can be used once each. Sessions record whether the login used a second factor.
+
+CREATE TABLE IF NOT EXISTS `two_factor` (
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `secret` varchar(64) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `enabled_at` timestamp NULL DEFAULT NULL,
+  `last_used_step` bigint(20) NOT NULL DEFAULT 0,
+  `failed_attempts` int(11) NOT NULL DEFAULT 0,
+  `last_failed_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `recovery_codes_user_id` (`user_id`)
+);
+
+ALTER TABLE `sessions` ADD COLUMN `two_factor` tinyint(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Failed logins per email address, registered or not, for brute-force
+-- protection. A row is removed on a successful login or an admin unlock.
+
+CREATE TABLE IF NOT EXISTS `login_failures` (
+  `email` varchar(255) NOT NULL,
+  `failed_attempts` int(11) NOT NULL DEFAULT 0,
+  `last_failed_at` timestamp NULL DEFAULT NULL,
+  `locked_until` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`email`)
+);
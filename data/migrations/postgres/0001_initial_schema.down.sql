@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS conversations;
+DROP TABLE IF EXISTS tickets;
+DROP TABLE IF EXISTS access_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,53 @@
+-- Initial schema, mirroring the MySQL tables. Identifiers are unquoted, so
+-- PostgreSQL folds them to lower case in both the schema and the queries.
+-- Emails use citext to match MySQL's case-insensitive comparisons.
+
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS users (
+  id BIGSERIAL PRIMARY KEY,
+  email CITEXT NOT NULL UNIQUE,
+  first_name VARCHAR(255) DEFAULT NULL,
+  last_name VARCHAR(255) DEFAULT NULL,
+  password VARCHAR(255) NOT NULL,
+  pin_number VARCHAR(255) DEFAULT NULL,
+  user_active INTEGER DEFAULT NULL,
+  is_admin INTEGER DEFAULT NULL,
+  refreshJWT TEXT DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT DEFAULT NULL,
+  email CITEXT NOT NULL,
+  accessJWT TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS access_tokens_access_jwt ON access_tokens (accessJWT);
+
+CREATE TABLE IF NOT EXISTS tickets (
+  id BIGSERIAL PRIMARY KEY,
+  userId BIGINT NOT NULL,
+  email CITEXT NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  issue VARCHAR(255) DEFAULT NULL,
+  status VARCHAR(50) NOT NULL,
+  dateOpened TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS tickets_user_id ON tickets (userId);
+
+CREATE TABLE IF NOT EXISTS conversations (
+  id BIGSERIAL PRIMARY KEY,
+  ticketId BIGINT NOT NULL,
+  sender VARCHAR(255) NOT NULL,
+  message TEXT NOT NULL,
+  messageSentAt TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS conversations_ticket_id ON conversations (ticketId);
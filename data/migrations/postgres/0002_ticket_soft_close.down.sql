@@ -0,0 +1,3 @@
+ALTER TABLE tickets
+  DROP COLUMN closedAt,
+  DROP COLUMN closedBy;
@@ -0,0 +1,5 @@
+-- Closing a ticket keeps it and records when and by whom it was closed.
+
+ALTER TABLE tickets
+  ADD COLUMN closedAt TIMESTAMPTZ DEFAULT NULL,
+  ADD COLUMN closedBy BIGINT DEFAULT NULL;
@@ -0,0 +1,8 @@
+-- Tickets carry a priority and an optional severity; the admin queue is
+-- ordered by priority and then by age.
+
+ALTER TABLE tickets
+  ADD COLUMN priority VARCHAR(20) NOT NULL DEFAULT 'normal',
+  ADD COLUMN severity VARCHAR(20) DEFAULT NULL;
+
+CREATE INDEX tickets_priority ON tickets (priority, dateOpened);
@@ -0,0 +1,5 @@
+ALTER TABLE conversations DROP COLUMN senderId;
+
+DROP INDEX tickets_assigned_to;
+
+ALTER TABLE tickets DROP COLUMN assignedTo;
@@ -0,0 +1,8 @@
+-- Tickets can be assigned to an operator, and every message records the
+-- ID of the user who sent it.
+
+ALTER TABLE tickets ADD COLUMN assignedTo BIGINT DEFAULT NULL;
+
+CREATE INDEX tickets_assigned_to ON tickets (assignedTo);
+
+ALTER TABLE conversations ADD COLUMN senderId BIGINT DEFAULT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT DEFAULT NULL,
+  email CITEXT NOT NULL,
+  accessJWT TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS access_tokens_access_jwt ON access_tokens (accessJWT);
+
+DROP TABLE IF EXISTS sessions;
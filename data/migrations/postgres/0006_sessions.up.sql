@@ -0,0 +1,18 @@
+-- Each login creates a session, so a user can be signed in on several
+-- devices at once and revoke them one by one. Sessions replace the single
+-- access token row per user.
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ DEFAULT NULL,
+  last_seen_at TIMESTAMPTZ DEFAULT NULL,
+  expires_at TIMESTAMPTZ DEFAULT NULL,
+  revoked_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+DROP TABLE IF EXISTS access_tokens;
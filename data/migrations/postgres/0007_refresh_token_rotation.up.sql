@@ -0,0 +1,19 @@
+-- Refresh tokens are rotated on every use. Each session stores the ID of
+-- its current refresh token; presenting an older one revokes the session and
+-- is recorded as a security event.
+
+ALTER TABLE sessions
+  ADD COLUMN refresh_token_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS security_events (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  session_id BIGINT DEFAULT NULL,
+  event_type VARCHAR(50) NOT NULL,
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  details VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS security_events_user_id ON security_events (user_id);
@@ -0,0 +1,13 @@
+-- Password reset tokens emailed by POST /password/forgot. Only a hash of each
+-- token is stored; a token can be used once, before it expires.
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ DEFAULT NULL,
+  expires_at TIMESTAMPTZ DEFAULT NULL,
+  used_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_id ON password_resets (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+  DROP COLUMN pending_email,
+  DROP COLUMN pending_email_pin;
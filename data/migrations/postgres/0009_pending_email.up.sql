@@ -0,0 +1,6 @@
+-- A new email address only replaces the current one once the user enters
+-- the PIN sent to it.
+
+ALTER TABLE users
+  ADD COLUMN pending_email CITEXT DEFAULT NULL,
+  ADD COLUMN pending_email_pin VARCHAR(255) DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN pending_email_pin VARCHAR(255) DEFAULT NULL;
+
+DROP TABLE IF EXISTS verification_pins;
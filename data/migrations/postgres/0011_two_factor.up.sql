@@ -0,0 +1,23 @@
+-- TOTP two-factor authentication. Recovery codes are stored as hashes and
+-- can be used once each. Sessions record whether the login used a second factor.
+
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id BIGINT PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NULL,
+  enabled_at TIMESTAMPTZ DEFAULT NULL,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id ON recovery_codes (user_id);
+
+ALTER TABLE sessions ADD COLUMN two_factor BOOLEAN NOT NULL DEFAULT FALSE;
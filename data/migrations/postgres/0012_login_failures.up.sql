@@ -0,0 +1,9 @@
+-- Failed logins per email address, registered or not, for brute-force
+-- protection. A row is removed on a successful login or an admin unlock.
+
+CREATE TABLE IF NOT EXISTS login_failures (
+  email CITEXT PRIMARY KEY,
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMPTZ DEFAULT NULL,
+  locked_until TIMESTAMPTZ DEFAULT NULL
+);
@@ -0,0 +1,6 @@
+-- User roles. Administrators keep their access; everyone else starts as a
+-- customer. is_admin is kept in step with the role.
+
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'customer';
+
+UPDATE users SET role = 'admin' WHERE is_admin = 1;
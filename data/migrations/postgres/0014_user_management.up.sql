@@ -0,0 +1,6 @@
+-- Administrators can deactivate users, and security events record the
+-- administrator who caused them.
+
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMPTZ DEFAULT NULL;
+
+ALTER TABLE security_events ADD COLUMN actor_id BIGINT DEFAULT NULL;
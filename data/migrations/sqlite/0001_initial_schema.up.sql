@@ -0,0 +1,49 @@
+-- Initial schema, mirroring the MySQL tables. Emails compare case-insensitively as they do in MySQL.
+
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+  first_name TEXT DEFAULT NULL,
+  last_name TEXT DEFAULT NULL,
+  password TEXT NOT NULL,
+  pin_number TEXT DEFAULT NULL,
+  user_active INTEGER DEFAULT NULL,
+  is_admin INTEGER DEFAULT NULL,
+  refreshJWT TEXT DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER DEFAULT NULL,
+  email TEXT NOT NULL COLLATE NOCASE,
+  accessJWT TEXT NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS access_tokens_access_jwt ON access_tokens (accessJWT);
+
+CREATE TABLE IF NOT EXISTS tickets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  userId INTEGER NOT NULL,
+  email TEXT NOT NULL COLLATE NOCASE,
+  subject TEXT NOT NULL,
+  issue TEXT DEFAULT NULL,
+  status TEXT NOT NULL,
+  dateOpened DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS tickets_user_id ON tickets (userId);
+
+CREATE TABLE IF NOT EXISTS conversations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  ticketId INTEGER NOT NULL,
+  sender TEXT NOT NULL,
+  message TEXT NOT NULL,
+  messageSentAt DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS conversations_ticket_id ON conversations (ticketId);
@@ -0,0 +1,3 @@
+ALTER TABLE tickets DROP COLUMN closedAt;
+
+ALTER TABLE tickets DROP COLUMN closedBy;
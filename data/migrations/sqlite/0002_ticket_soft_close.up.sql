@@ -0,0 +1,5 @@
+-- Closing a ticket keeps it and records when and by whom it was closed.
+
+ALTER TABLE tickets ADD COLUMN closedAt DATETIME DEFAULT NULL;
+
+ALTER TABLE tickets ADD COLUMN closedBy INTEGER DEFAULT NULL;
@@ -0,0 +1,5 @@
+DROP INDEX tickets_priority;
+
+ALTER TABLE tickets DROP COLUMN priority;
+
+ALTER TABLE tickets DROP COLUMN severity;
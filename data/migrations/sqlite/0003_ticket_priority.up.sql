@@ -0,0 +1,8 @@
+-- Tickets carry a priority and an optional severity; the admin queue is
+-- ordered by priority and then by age.
+
+ALTER TABLE tickets ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal';
+
+ALTER TABLE tickets ADD COLUMN severity TEXT DEFAULT NULL;
+
+CREATE INDEX tickets_priority ON tickets (priority, dateOpened);
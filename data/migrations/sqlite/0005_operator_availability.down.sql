@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN available;
+
+ALTER TABLE users DROP COLUMN out_of_office_until;
+
+ALTER TABLE users DROP COLUMN last_assigned_at;
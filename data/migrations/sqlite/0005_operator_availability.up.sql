@@ -0,0 +1,8 @@
+-- Operators can mark themselves unavailable or out of office, and the time
+-- each operator was last given a ticket drives round-robin assignment.
+
+ALTER TABLE users ADD COLUMN available INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE users ADD COLUMN out_of_office_until DATETIME DEFAULT NULL;
+
+ALTER TABLE users ADD COLUMN last_assigned_at DATETIME DEFAULT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS access_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER DEFAULT NULL,
+  email TEXT NOT NULL COLLATE NOCASE,
+  accessJWT TEXT NOT NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS access_tokens_access_jwt ON access_tokens (accessJWT);
+
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,18 @@
+-- Each login creates a session, so a user can be signed in on several
+-- devices at once and revoke them one by one. Sessions replace the single
+-- access token row per user.
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip_address TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT NULL,
+  last_seen_at DATETIME DEFAULT NULL,
+  expires_at DATETIME DEFAULT NULL,
+  revoked_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+DROP TABLE IF EXISTS access_tokens;
@@ -0,0 +1,18 @@
+-- Refresh tokens are rotated on every use. Each session stores the ID of
+-- its current refresh token; presenting an older one revokes the session and
+-- is recorded as a security event.
+
+ALTER TABLE sessions ADD COLUMN refresh_token_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS security_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  session_id INTEGER DEFAULT NULL,
+  event_type TEXT NOT NULL,
+  ip_address TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  details TEXT NOT NULL DEFAULT '',
+  created_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS security_events_user_id ON security_events (user_id);
@@ -0,0 +1,13 @@
+-- Password reset tokens emailed by POST /password/forgot. Only a hash of each
+-- token is stored; a token can be used once, before it expires.
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at DATETIME DEFAULT NULL,
+  expires_at DATETIME DEFAULT NULL,
+  used_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_id ON password_resets (user_id);
@@ -0,0 +1,6 @@
+-- A new email address only replaces the current one once the user enters
+-- the PIN sent to it.
+
+ALTER TABLE users ADD COLUMN pending_email TEXT DEFAULT NULL COLLATE NOCASE;
+
+ALTER TABLE users ADD COLUMN pending_email_pin TEXT DEFAULT NULL;
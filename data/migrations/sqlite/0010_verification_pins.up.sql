@@ -0,0 +1,18 @@
+-- PINs emailed to verify an account or a new email address. Only a hash of
+-- each PIN is stored; a PIN expires and only accepts a few attempts.
+-- Plain-text PINs of unverified accounts are cleared; they can ask for a new one.
+
+CREATE TABLE IF NOT EXISTS verification_pins (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  purpose TEXT NOT NULL,
+  pin_hash TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME DEFAULT NULL,
+  expires_at DATETIME DEFAULT NULL,
+  UNIQUE (user_id, purpose)
+);
+
+UPDATE users SET pin_number = NULL WHERE pin_number <> 'N/A - verified';
+
+ALTER TABLE users DROP COLUMN pending_email_pin;
@@ -0,0 +1,23 @@
+-- TOTP two-factor authentication. Recovery codes are stored as hashes and
+-- can be used once each. Sessions record whether the login used a second factor.
+
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id INTEGER PRIMARY KEY,
+  secret TEXT NOT NULL,
+  created_at DATETIME DEFAULT NULL,
+  enabled_at DATETIME DEFAULT NULL,
+  last_used_step INTEGER NOT NULL DEFAULT 0,
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_at DATETIME DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id ON recovery_codes (user_id);
+
+ALTER TABLE sessions ADD COLUMN two_factor INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Failed logins per email address, registered or not, for brute-force
+-- protection. A row is removed on a successful login or an admin unlock.
+
+CREATE TABLE IF NOT EXISTS login_failures (
+  email TEXT PRIMARY KEY COLLATE NOCASE,
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_at DATETIME DEFAULT NULL,
+  locked_until DATETIME DEFAULT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE security_events DROP COLUMN actor_id;
+
+ALTER TABLE users DROP COLUMN deactivated_at;
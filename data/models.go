@@ -1,13 +1,11 @@
 package data
 
-import (
-	"database/sql"
-	"time"
-)
+import "time"
 
 const dbTimeout = time.Second * 3
 
-var db *sql.DB
+// PinVerified is stored in place of the PIN once a user has verified their account
+const PinVerified = "N/A - verified"
 
 // User structure represents the attributes of a user in the system.
 type User struct {
@@ -16,36 +14,113 @@ type User struct {
 	FirstName  string // First name of the user
 	LastName   string // Last name of the user
 	Password   string // Hashed password of the user
-	PinNumber  string // PIN number associated with the user
+	PinNumber  string // PinVerified once the account is verified; PINs are kept in verification_pins
 	UserActive int    // Flag indicating whether the user account is active (1) or not (0)
-	IsAdmin    int    // Flag indicating whether the user is an administrator (1) or not (0)
+	IsAdmin    int    // Flag indicating whether the user is an administrator (1) or not (0), kept in step with Role
+	Role       string // Role of the user (see roles.go)
 	RefreshJWT string // Refresh JSON Web Token (JWT) for the user
+
+	DeactivatedAt *time.Time // Date and time an administrator deactivated the account, if they did
+}
+
+// Session represents a login of a user on one device. Access and refresh
+// tokens carry the ID of the session they were issued for.
+type Session struct {
+	ID         int64      `json:"id"`                  // Unique identifier for the session
+	UserID     int        `json:"userId"`              // ID of the user who logged in
+	UserAgent  string     `json:"userAgent"`           // User agent of the client that logged in
+	IPAddress  string     `json:"ipAddress"`           // IP address the login came from
+	CreatedAt  time.Time  `json:"createdAt"`           // Date and time of the login
+	LastSeenAt time.Time  `json:"lastSeenAt"`          // Date and time the session was last used
+	ExpiresAt  time.Time  `json:"expiresAt"`           // Date and time after which the session can no longer be used
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"` // Date and time the session was revoked, if it was
+	TwoFactor  bool       `json:"twoFactor"`           // Whether the login was confirmed with a second factor
+
+	RefreshTokenID string `json:"-"` // ID of the only refresh token of the session that may still be used
+}
+
+// VerificationPin represents a PIN emailed to a user to verify an email address.
+type VerificationPin struct {
+	ID        int64     // Unique identifier for the PIN
+	UserID    int       // ID of the user the PIN was sent to
+	Purpose   string    // What the PIN verifies, e.g. PinPurposeAccount
+	PinHash   string    // Hash of the PIN; the PIN itself is only emailed
+	Attempts  int       // Number of times the PIN was entered
+	CreatedAt time.Time // Date and time the PIN was sent
+	ExpiresAt time.Time // Date and time after which the PIN can no longer be used
+}
+
+// TwoFactor represents the TOTP authenticator of a user. It is pending until
+// the user confirms enrolment with a first code.
+type TwoFactor struct {
+	UserID         int        // ID of the user the authenticator belongs to
+	Secret         string     // Base32 encoded TOTP secret shared with the authenticator app
+	CreatedAt      time.Time  // Date and time enrolment started
+	EnabledAt      *time.Time // Date and time enrolment was confirmed; nil while pending
+	LastUsedStep   int64      // Time step of the last accepted code, which can not be used again
+	FailedAttempts int        // Number of codes entered since the last accepted one, counted before each is checked
+	LastFailedAt   *time.Time // Date and time of the last code counted, if any
+}
+
+// Enabled reports whether the user confirmed enrolment
+func (t *TwoFactor) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// LoginFailures tracks the failed logins with one email address, registered
+// or not, so that unknown addresses are throttled like real accounts.
+type LoginFailures struct {
+	Email          string     // Email address the logins were attempted with
+	FailedAttempts int        // Number of failed logins since the last successful one
+	LastFailedAt   *time.Time // Date and time of the last failed login, if any
+	LockedUntil    *time.Time // Date and time until which logins are refused, if locked
+}
+
+// PasswordReset represents a password reset token emailed to a user.
+type PasswordReset struct {
+	ID        int64      // Unique identifier for the reset token
+	UserID    int        // ID of the user whose password can be reset
+	TokenHash string     // SHA-256 hash of the token; the token itself is never stored
+	CreatedAt time.Time  // Date and time the token was issued
+	ExpiresAt time.Time  // Date and time after which the token can no longer be used
+	UsedAt    *time.Time // Date and time the token was used or invalidated, if it was
 }
 
-// AccessToken structure represents the access token associated with a user.
-type AccessToken struct {
-	ID        int    // Unique identifier for the access token
-	UserID    int    // ID of the user associated with the access token
-	Email     string // Email address of the user
-	AccessJWT string // Access JSON Web Token (JWT)
+// SecurityEvent records suspicious activity on a user's account.
+type SecurityEvent struct {
+	ID        int64     `json:"id"`                  // Unique identifier for the event
+	UserID    int       `json:"userId"`              // ID of the user the event concerns
+	SessionID *int64    `json:"sessionId,omitempty"` // ID of the session involved, if any
+	Type      string    `json:"type"`                // Kind of event (see security_events.go)
+	IPAddress string    `json:"ipAddress"`           // IP address of the request that caused the event
+	UserAgent string    `json:"userAgent"`           // User agent of the request that caused the event
+	Details   string    `json:"details"`             // Human readable description of the event
+	ActorID   *int      `json:"actorId,omitempty"`   // ID of the administrator who caused the event, if one did
+	CreatedAt time.Time `json:"createdAt"`           // Date and time of the event
 }
 
 // Ticket represents the structure of a ticket in the system.
 type Ticket struct {
-	ID         int64     `json:"id"`          // Unique identifier for the ticket
-	UserID     int64     `json:"userId"`      // ID of the user who opened the ticket
-	Email      string    `json:"email"`       // Email address of the user who opened the ticket
-	Subject    string    `json:"subject"`     // Subject of the ticket
-	Issue      string    `json:"issue"`       // Description of the issue
-	Status     string    `json:"status"`      // Status of the ticket (e.g., open, closed)
-	DateOpened time.Time `json:"dateOpened"`  // Date and time when the ticket was opened
+	ID         int64      `json:"id"`                   // Unique identifier for the ticket
+	UserID     int64      `json:"userId"`               // ID of the user who opened the ticket
+	Email      string     `json:"email"`                // Email address of the user who opened the ticket
+	Subject    string     `json:"subject"`              // Subject of the ticket
+	Issue      string     `json:"issue"`                // Description of the issue
+	Status     string     `json:"status"`               // Status of the ticket (see ticket_status.go)
+	Priority   string     `json:"priority"`             // Priority of the ticket (low, normal, high, urgent)
+	Severity   *string    `json:"severity,omitempty"`   // Impact of the issue, if it has been assessed
+	DateOpened time.Time  `json:"dateOpened"`           // Date and time when the ticket was opened
+	ClosedAt   *time.Time `json:"closedAt,omitempty"`   // Date and time when the ticket was closed, if it is closed
+	ClosedBy   *int64     `json:"closedBy,omitempty"`   // ID of the user who closed the ticket, if it is closed
+	AssignedTo *int64     `json:"assignedTo,omitempty"` // ID of the operator the ticket is assigned to, if any
 }
 
 // Conversation represents a message within a ticket conversation.
 type Conversation struct {
-	ID            int64     `json:"id"`            // Unique identifier for the conversation message
-	TicketID      int64     `json:"ticketId"`      // ID of the ticket associated with the conversation
-	Sender        string    `json:"sender"`        // Sender of the message
-	Message       string    `json:"message"`       // Content of the message
-	MessageSentAt time.Time `json:"messageSentAt"` // Date and time when the message was sent
+	ID            int64     `json:"id"`                 // Unique identifier for the conversation message
+	TicketID      int64     `json:"ticketId"`           // ID of the ticket associated with the conversation
+	Sender        string    `json:"sender"`             // Sender of the message
+	SenderID      *int64    `json:"senderId,omitempty"` // ID of the user who sent the message; empty for automatic messages
+	Message       string    `json:"message"`            // Content of the message
+	MessageSentAt time.Time `json:"messageSentAt"`      // Date and time when the message was sent
 }
@@ -0,0 +1,76 @@
+// password_resets.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrPasswordResetNotFound is returned when a password reset token does not
+// exist or can no longer be used
+var ErrPasswordResetNotFound = errors.New("password reset token not found")
+
+// CreatePasswordReset stores a new password reset token and returns its ID
+func (s *SQLStore) CreatePasswordReset(reset *PasswordReset) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        INSERT INTO password_resets (user_id, token_hash, created_at, expires_at)
+        VALUES (?, ?, ?, ?)`
+
+	return s.insert(ctx, stmt, reset.UserID, reset.TokenHash, reset.CreatedAt, reset.ExpiresAt)
+}
+
+// GetPasswordReset retrieves a password reset token by the hash of the token
+func (s *SQLStore) GetPasswordReset(tokenHash string) (*PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT id, user_id, token_hash, created_at, expires_at, used_at
+        FROM password_resets
+        WHERE token_hash = ?`
+
+	var reset PasswordReset
+	err := s.queryRow(ctx, query, tokenHash).Scan(
+		&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.CreatedAt,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPasswordResetNotFound
+		}
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// UsePasswordResets marks every unused password reset token of a user as
+// used. It returns ErrPasswordResetNotFound when there was none left, e.g.
+// because a concurrent request used them first.
+func (s *SQLStore) UsePasswordResets(userID int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", at, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPasswordResetNotFound
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// postgres_store.go
+package data
+
+import "database/sql"
+
+// NewPostgresStore returns a Store backed by the given PostgreSQL connection.
+// The schema is managed with the embedded migrations (see MigrateUp).
+func NewPostgresStore(database *sql.DB) *SQLStore {
+	return &SQLStore{db: database, dialect: postgresDialect}
+}
@@ -0,0 +1,42 @@
+// roles.go
+package data
+
+// User roles. The permissions of each role are decided by the API.
+const (
+	// RoleCustomer is the role of users who open tickets
+	RoleCustomer = "customer"
+	// RoleAgent is the role of operators who work on tickets
+	RoleAgent = "agent"
+	// RoleSupervisor is the role of team leads, who also assign tickets and
+	// see reports
+	RoleSupervisor = "supervisor"
+	// RoleAdmin is the role of administrators, who may do anything
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role, from the least to the most privileged
+var Roles = []string{RoleCustomer, RoleAgent, RoleSupervisor, RoleAdmin}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// StaffRole reports whether users with role work on tickets, and so can be
+// assigned them
+func StaffRole(role string) bool {
+	return role == RoleAgent || role == RoleSupervisor || role == RoleAdmin
+}
+
+// isAdminFlag returns the is_admin column value kept in step with a role
+func isAdminFlag(role string) int {
+	if role == RoleAdmin {
+		return 1
+	}
+	return 0
+}
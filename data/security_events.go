@@ -0,0 +1,80 @@
+// security_events.go
+package data
+
+import "context"
+
+// Security event types
+const (
+	// SecurityEventRefreshTokenReuse is recorded when a refresh token is used
+	// twice. The session it belongs to is revoked.
+	SecurityEventRefreshTokenReuse = "refresh-token-reuse"
+	// SecurityEventPasswordReset is recorded when a password is reset with an
+	// emailed token. Every session of the user is revoked.
+	SecurityEventPasswordReset = "password-reset"
+	// SecurityEventPasswordChange is recorded when a user changes their
+	// password. Their other sessions are revoked.
+	SecurityEventPasswordChange = "password-change"
+	// SecurityEventEmailChange is recorded when a user changes their email address
+	SecurityEventEmailChange = "email-change"
+	// SecurityEventTwoFactorEnabled is recorded when a user confirms TOTP enrolment
+	SecurityEventTwoFactorEnabled = "two-factor-enabled"
+	// SecurityEventTwoFactorDisabled is recorded when a user removes their authenticator
+	SecurityEventTwoFactorDisabled = "two-factor-disabled"
+	// SecurityEventRecoveryCodesRegenerated is recorded when a user replaces
+	// their recovery codes. The previous codes stop working.
+	SecurityEventRecoveryCodesRegenerated = "recovery-codes-regenerated"
+	// SecurityEventRecoveryCodeUsed is recorded when a user logs in with a
+	// recovery code instead of their authenticator
+	SecurityEventRecoveryCodeUsed = "recovery-code-used"
+	// SecurityEventAccountLocked is recorded when too many failed logins lock
+	// an account
+	SecurityEventAccountLocked = "account-locked"
+	// SecurityEventAccountUnlocked is recorded when an administrator lifts the
+	// lock on an account
+	SecurityEventAccountUnlocked = "account-unlocked"
+	// SecurityEventRoleChange is recorded when an administrator changes the
+	// role of a user
+	SecurityEventRoleChange = "role-change"
+	// SecurityEventAccountDeactivated is recorded when an administrator
+	// deactivates an account. Its sessions are revoked.
+	SecurityEventAccountDeactivated = "account-deactivated"
+	// SecurityEventAccountReactivated is recorded when an administrator
+	// reactivates an account
+	SecurityEventAccountReactivated = "account-reactivated"
+	// SecurityEventForcedLogout is recorded when an administrator revokes every
+	// session of a user
+	SecurityEventForcedLogout = "forced-logout"
+	// SecurityEventVerificationResent is recorded when an administrator sends
+	// a user a new account verification PIN
+	SecurityEventVerificationResent = "verification-resent"
+	// SecurityEventUserDeleted is recorded when an administrator deletes a
+	// user. The security events of the user are kept.
+	SecurityEventUserDeleted = "user-deleted"
+	// SecurityEventImpersonation is recorded when an administrator gets a
+	// token to act as a user
+	SecurityEventImpersonation = "impersonation"
+	// SecurityEventImpersonatedChange is recorded for each request that may
+	// change something, made by an administrator impersonating the user
+	SecurityEventImpersonatedChange = "impersonated-change"
+)
+
+// RecordSecurityEvent stores a security event and returns its ID
+func (s *SQLStore) RecordSecurityEvent(event *SecurityEvent) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        INSERT INTO security_events (user_id, session_id, event_type, ip_address, user_agent, details, actor_id, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return s.insert(ctx, stmt,
+		event.UserID,
+		event.SessionID,
+		event.Type,
+		event.IPAddress,
+		event.UserAgent,
+		event.Details,
+		event.ActorID,
+		event.CreatedAt,
+	)
+}
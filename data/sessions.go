@@ -0,0 +1,192 @@
+// sessions.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned when a session does not exist, belongs to
+	// another user or has already been revoked
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRefreshTokenReused is returned when a refresh token that was already
+	// exchanged for a new one is presented again
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+)
+
+// sessionColumns are the columns read into a Session, in scan order
+const sessionColumns = "id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, two_factor, refresh_token_id"
+
+// sessionFields returns the destinations for sessionColumns
+func sessionFields(session *Session) []interface{} {
+	return []interface{}{
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.TwoFactor,
+		&session.RefreshTokenID,
+	}
+}
+
+// Active reports whether the session can still be used at the given time
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// CreateSession stores a new session and returns its ID
+func (s *SQLStore) CreateSession(session *Session) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        INSERT INTO sessions (user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, two_factor, refresh_token_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return s.insert(ctx, stmt,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+		session.TwoFactor,
+		session.RefreshTokenID,
+	)
+}
+
+// GetSession retrieves a session by ID, whether or not it is still active
+func (s *SQLStore) GetSession(sessionID int64) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var session Session
+	err := s.queryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", sessionID).
+		Scan(sessionFields(&session)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSessionsByUserID returns the sessions of a user that are active at the
+// given time, most recently used first
+func (s *SQLStore) GetSessionsByUserID(userID int, now time.Time) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_seen_at DESC, id DESC"
+	rows, err := s.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(sessionFields(&session)...); err != nil {
+			return nil, err
+		}
+		// Expiry is checked here rather than in SQL, as the dialects store
+		// timestamps differently
+		if !session.Active(now) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that a session was used at the given time
+func (s *SQLStore) TouchSession(sessionID int64, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", at, sessionID)
+	return err
+}
+
+// RotateRefreshToken replaces the current refresh token of an active session
+// and records the session as used. It returns ErrRefreshTokenReused when from
+// is no longer the current refresh token, e.g. because a concurrent request
+// rotated it first.
+func (s *SQLStore) RotateRefreshToken(sessionID int64, from, to string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE sessions
+        SET refresh_token_id = ?, last_seen_at = ?
+        WHERE id = ? AND refresh_token_id = ? AND revoked_at IS NULL`
+
+	result, err := s.exec(ctx, stmt, to, at, sessionID, from)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// RevokeSession revokes one session of a user. It returns ErrSessionNotFound
+// when the session does not belong to the user or is already revoked.
+func (s *SQLStore) RevokeSession(userID int, sessionID int64, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		at, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of a user except keepSessionID
+// and returns how many were revoked. A keepSessionID of 0 revokes them all.
+func (s *SQLStore) RevokeOtherSessions(userID int, keepSessionID int64, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		at, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
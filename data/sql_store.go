@@ -0,0 +1,106 @@
+// sql_store.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect captures the SQL differences between the supported databases.
+// Queries are written with ? placeholders and rewritten where needed.
+type dialect struct {
+	// name selects the embedded migrations for the dialect
+	name string
+	// numberedPlaceholders rewrites ? placeholders as $1, $2, ... (PostgreSQL)
+	numberedPlaceholders bool
+	// returningID reads generated IDs with RETURNING id instead of LastInsertId
+	returningID bool
+	// onDuplicateKey writes upserts with ON DUPLICATE KEY UPDATE (MySQL)
+	// instead of ON CONFLICT ... DO UPDATE SET
+	onDuplicateKey bool
+}
+
+var (
+	mysqlDialect    = dialect{name: "mysql", onDuplicateKey: true}
+	sqliteDialect   = dialect{name: "sqlite"}
+	postgresDialect = dialect{name: "postgres", numberedPlaceholders: true, returningID: true}
+)
+
+// upsertClause returns the clause that turns an INSERT into an update of the
+// row with the same key, to be followed by the assignments to make
+func (d dialect) upsertClause(key string) string {
+	if d.onDuplicateKey {
+		return "ON DUPLICATE KEY UPDATE"
+	}
+	return "ON CONFLICT (" + key + ") DO UPDATE SET"
+}
+
+// SQLStore implements Store on top of a database/sql connection.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewMySQLStore returns a Store backed by the given MySQL connection.
+// The connection must be opened with parseTime=true so that DATETIME and
+// TIMESTAMP columns scan into time.Time, and with clientFoundRows=true so that
+// an update which leaves a row unchanged still counts it as affected.
+func NewMySQLStore(database *sql.DB) *SQLStore {
+	return &SQLStore{db: database, dialect: mysqlDialect}
+}
+
+// DB returns the underlying database connection
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// rebind rewrites the ? placeholders in query for the store's dialect
+func (s *SQLStore) rebind(query string) string {
+	if !s.dialect.numberedPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// exec runs a statement that returns no rows
+func (s *SQLStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+// query runs a statement that returns rows
+func (s *SQLStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+// queryRow runs a statement that returns at most one row
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+// insert runs an INSERT statement and returns the ID generated for the new row
+func (s *SQLStore) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	if s.dialect.returningID {
+		var id int64
+		err := s.queryRow(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
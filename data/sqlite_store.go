@@ -0,0 +1,10 @@
+// sqlite_store.go
+package data
+
+import "database/sql"
+
+// NewSQLiteStore returns a Store backed by the given SQLite connection.
+// The schema is managed with the embedded migrations (see MigrateUp).
+func NewSQLiteStore(database *sql.DB) *SQLStore {
+	return &SQLStore{db: database, dialect: sqliteDialect}
+}
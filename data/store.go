@@ -0,0 +1,121 @@
+// store.go
+package data
+
+import "time"
+
+// Store is the persistence layer used by the handlers in cmd/web.
+// Each backend (MySQL by default) implements the full interface so that
+// handlers never talk to a database connection directly.
+type Store interface {
+	UserStore
+	SessionStore
+	SecurityEventStore
+	PasswordResetStore
+	VerificationPinStore
+	TwoFactorStore
+	LoginFailureStore
+	TicketStore
+	ConversationStore
+	OperatorStore
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	CreateUser(u *User) (int, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByID(userID int) (*User, error)
+	GetUserEmailByID(userID int) (string, error)
+	UserExists(email string) (bool, error)
+	ActivateAccount(userID int) error
+	UpdatePinAfterVerification(userID int) error
+	UpdatePassword(userID int, passwordHash string) error
+	UpdateUserName(userID int, firstName, lastName string) error
+	SetUserRole(userID int, role string) error
+	ListUsers(filter UserFilter) ([]User, int, error)
+	SetUserDeactivated(userID int, at *time.Time) error
+	DeleteUser(userID int) error
+	SetPendingEmail(userID int, email string) error
+	GetPendingEmail(userID int) (string, error)
+	ConfirmPendingEmail(userID int, email string) error
+}
+
+// SessionStore persists the login sessions of users.
+type SessionStore interface {
+	CreateSession(session *Session) (int64, error)
+	GetSession(sessionID int64) (*Session, error)
+	GetSessionsByUserID(userID int, now time.Time) ([]Session, error)
+	TouchSession(sessionID int64, at time.Time) error
+	RotateRefreshToken(sessionID int64, from, to string, at time.Time) error
+	RevokeSession(userID int, sessionID int64, at time.Time) error
+	RevokeOtherSessions(userID int, keepSessionID int64, at time.Time) (int, error)
+}
+
+// SecurityEventStore persists security events.
+type SecurityEventStore interface {
+	RecordSecurityEvent(event *SecurityEvent) (int64, error)
+}
+
+// PasswordResetStore persists password reset tokens.
+type PasswordResetStore interface {
+	CreatePasswordReset(reset *PasswordReset) (int64, error)
+	GetPasswordReset(tokenHash string) (*PasswordReset, error)
+	UsePasswordResets(userID int, at time.Time) error
+}
+
+// VerificationPinStore persists the PINs emailed to verify email addresses.
+type VerificationPinStore interface {
+	ReplaceVerificationPin(pin *VerificationPin) (int64, error)
+	GetVerificationPin(userID int, purpose string) (*VerificationPin, error)
+	RecordPinAttempt(pinID int64, maxAttempts int) error
+	DeleteVerificationPin(userID int, purpose string) error
+}
+
+// TwoFactorStore persists TOTP authenticators and recovery codes.
+type TwoFactorStore interface {
+	CreateTwoFactor(twoFactor *TwoFactor) error
+	GetTwoFactor(userID int) (*TwoFactor, error)
+	EnableTwoFactor(userID int, step int64, codeHashes []string, at time.Time) error
+	UseTotpStep(userID int, step int64) error
+	RecordTwoFactorAttempt(userID, maxAttempts int, at time.Time) (int, error)
+	ResetTwoFactorAttempts(userID, seenAttempts int) error
+	DeleteTwoFactor(userID int) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string, at time.Time) error
+	CountRecoveryCodes(userID int) (int, error)
+}
+
+// LoginFailureStore persists failed login attempts per email address.
+type LoginFailureStore interface {
+	GetLoginFailures(email string) (*LoginFailures, error)
+	RecordLoginFailure(email string, at time.Time) (int, error)
+	LockLogin(email string, until time.Time) error
+	ClearLoginFailures(email string) error
+}
+
+// TicketStore persists support tickets.
+type TicketStore interface {
+	CreateTicket(userID int, subject, issue, priority string) (int, error)
+	GetTickets() ([]Ticket, error)
+	GetTicketsByUserID(userID int64) ([]Ticket, error)
+	GetTicketsByAssignee(assigneeID int64) ([]Ticket, error)
+	GetTicketByID(ticketID int64) (Ticket, error)
+	GetUserIDByTicketID(ticketID int64) (int64, error)
+	UpdateTicketStatus(ticketID int64, from, to string, changedBy int64) error
+	UpdateTicketPriority(ticketID int64, priority, severity string) error
+	AssignTicket(ticketID int64, from, to int64) error
+	PurgeTicket(ticketID int64) error
+}
+
+// ConversationStore persists the messages exchanged on a ticket.
+type ConversationStore interface {
+	AddConversation(ticketID int64, senderID int64, sender, message string) (int64, error)
+	GetConversationsByTicketID(ticketID int64) ([]Conversation, error)
+}
+
+// OperatorStore persists operator availability for automatic ticket assignment.
+type OperatorStore interface {
+	GetOperatorAvailability(userID int) (OperatorAvailability, error)
+	SetOperatorAvailability(availability OperatorAvailability) error
+	GetAssignableOperators(now time.Time) ([]OperatorLoad, error)
+	RecordTicketAssignment(userID int, at time.Time) error
+}
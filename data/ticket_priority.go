@@ -0,0 +1,63 @@
+// ticket_priority.go
+package data
+
+import "sort"
+
+// Ticket priorities, from least to most pressing
+const (
+	TicketPriorityLow    = "low"
+	TicketPriorityNormal = "normal"
+	TicketPriorityHigh   = "high"
+	TicketPriorityUrgent = "urgent"
+)
+
+// Ticket severities describe the impact of the issue, from least to most severe
+const (
+	TicketSeverityMinor    = "minor"
+	TicketSeverityModerate = "moderate"
+	TicketSeverityMajor    = "major"
+	TicketSeverityCritical = "critical"
+)
+
+// ticketPriorityRank orders priorities in the admin queue; lower ranks come first
+var ticketPriorityRank = map[string]int{
+	TicketPriorityUrgent: 0,
+	TicketPriorityHigh:   1,
+	TicketPriorityNormal: 2,
+	TicketPriorityLow:    3,
+}
+
+// ticketQueueOrder is the SQL equivalent of sortTicketQueue
+const ticketQueueOrder = `
+        CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END,
+        dateOpened, id`
+
+// ValidTicketPriority reports whether priority is a known ticket priority
+func ValidTicketPriority(priority string) bool {
+	_, ok := ticketPriorityRank[priority]
+	return ok
+}
+
+// ValidTicketSeverity reports whether severity is a known ticket severity.
+// Severity is optional, so the empty string is valid.
+func ValidTicketSeverity(severity string) bool {
+	switch severity {
+	case "", TicketSeverityMinor, TicketSeverityModerate, TicketSeverityMajor, TicketSeverityCritical:
+		return true
+	}
+	return false
+}
+
+// sortTicketQueue orders tickets by priority, then oldest first
+func sortTicketQueue(tickets []Ticket) {
+	sort.SliceStable(tickets, func(i, j int) bool {
+		ri, rj := ticketPriorityRank[tickets[i].Priority], ticketPriorityRank[tickets[j].Priority]
+		if ri != rj {
+			return ri < rj
+		}
+		if !tickets[i].DateOpened.Equal(tickets[j].DateOpened) {
+			return tickets[i].DateOpened.Before(tickets[j].DateOpened)
+		}
+		return tickets[i].ID < tickets[j].ID
+	})
+}
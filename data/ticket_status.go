@@ -0,0 +1,75 @@
+// ticket_status.go
+package data
+
+import "errors"
+
+// Ticket statuses
+const (
+	TicketStatusNew             = "new"
+	TicketStatusOpen            = "open"
+	TicketStatusPendingCustomer = "pending-customer"
+	TicketStatusPendingAgent    = "pending-agent"
+	TicketStatusOnHold          = "on-hold"
+	TicketStatusResolved        = "resolved"
+	TicketStatusClosed          = "closed"
+	TicketStatusReopened        = "reopened"
+)
+
+var (
+	// ErrInvalidTicketStatus is returned for a status outside the ticket lifecycle
+	ErrInvalidTicketStatus = errors.New("invalid ticket status")
+	// ErrTicketTransitionNotAllowed is returned when a ticket cannot move to the requested status
+	ErrTicketTransitionNotAllowed = errors.New("ticket status transition not allowed")
+	// ErrTicketStatusChanged is returned when a ticket's status changed while it was being updated
+	ErrTicketStatusChanged = errors.New("ticket status changed concurrently")
+)
+
+// unresolvedTicketTransitions are the statuses a customer may move a ticket
+// to while it is neither resolved nor closed
+var unresolvedTicketTransitions = []string{TicketStatusResolved, TicketStatusClosed}
+
+// customerTicketTransitions lists, for every status of the lifecycle, the
+// statuses a customer may move their own ticket to from it
+var customerTicketTransitions = map[string][]string{
+	TicketStatusNew:             unresolvedTicketTransitions,
+	TicketStatusOpen:            unresolvedTicketTransitions,
+	TicketStatusPendingCustomer: unresolvedTicketTransitions,
+	TicketStatusPendingAgent:    unresolvedTicketTransitions,
+	TicketStatusOnHold:          unresolvedTicketTransitions,
+	TicketStatusReopened:        unresolvedTicketTransitions,
+	TicketStatusResolved:        {TicketStatusClosed, TicketStatusReopened},
+	TicketStatusClosed:          {TicketStatusReopened},
+}
+
+// ValidTicketStatus reports whether status is part of the ticket lifecycle
+func ValidTicketStatus(status string) bool {
+	_, ok := customerTicketTransitions[status]
+	return ok
+}
+
+// CheckTicketTransition reports whether a ticket may move from one status to
+// another. Operators may move a ticket to any status, for example to correct
+// a mistake; customers may only resolve or close an unresolved ticket, close
+// a resolved one, and reopen a resolved or closed one.
+func CheckTicketTransition(from, to string, operator bool) error {
+	if !ValidTicketStatus(to) {
+		return ErrInvalidTicketStatus
+	}
+	if operator {
+		return nil
+	}
+	if !contains(customerTicketTransitions[from], to) {
+		return ErrTicketTransitionNotAllowed
+	}
+	return nil
+}
+
+// contains reports whether list includes value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
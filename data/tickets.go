@@ -4,18 +4,55 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"time"
 )
 
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// ErrTicketAssigneeChanged is returned when a ticket's assignee changed while it was being updated
+var ErrTicketAssigneeChanged = errors.New("ticket assignee changed concurrently")
+
+// InitialConversationMessage is the operator message added to every new ticket.
+const InitialConversationMessage = "We will be in touch with you shortly. In the meantime please feel free to reply to this message with more details"
+
+// ticketColumns lists the ticket columns in the order expected by ticketFields
+const ticketColumns = "id, userId, email, subject, issue, status, priority, severity, dateOpened, closedAt, closedBy, assignedTo"
+
+// ticketFields returns the scan destinations for ticketColumns
+func ticketFields(t *Ticket) []interface{} {
+	return []interface{}{&t.ID, &t.UserID, &t.Email, &t.Subject, &t.Issue, &t.Status, &t.Priority, &t.Severity, &t.DateOpened, &t.ClosedAt, &t.ClosedBy, &t.AssignedTo}
+}
+
+// scanTickets reads every ticket from rows selected with ticketColumns
+func scanTickets(rows *sql.Rows) ([]Ticket, error) {
+	defer rows.Close()
+
+	// Iterate over the result set and populate tickets slice
+	var tickets []Ticket
+	for rows.Next() {
+		var ticket Ticket
+		if err := rows.Scan(ticketFields(&ticket)...); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tickets, nil
+}
+
 // CreateTicket creates a new ticket in the database and returns its ID.
-func CreateTicket(userID int, subject, issue string) (int, error) {
+func (s *SQLStore) CreateTicket(userID int, subject, issue, priority string) (int, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Retrieve the user's email by userID
-	userEmail, err := GetUserEmailByID(userID)
+	userEmail, err := s.GetUserEmailByID(userID)
 	if err != nil {
 		log.Printf("Error retrieving user email: %v", err)
 		return 0, err
@@ -23,25 +60,18 @@ func CreateTicket(userID int, subject, issue string) (int, error) {
 
 	// Prepare the SQL statement to insert a new ticket
 	stmt := `
-        INSERT INTO tickets (userId, email, subject, issue, status, dateOpened)
-        VALUES (?, ?, ?, ?, ?, NOW())`
+        INSERT INTO tickets (userId, email, subject, issue, status, priority, dateOpened)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	// Execute the SQL statement
-	result, err := db.ExecContext(ctx, stmt, userID, userEmail, subject, issue, "open")
+	// Execute the SQL statement and retrieve the ID of the newly inserted ticket
+	ticketID, err := s.insert(ctx, stmt, userID, userEmail, subject, issue, TicketStatusNew, priority, time.Now())
 	if err != nil {
 		log.Printf("Error inserting ticket into database: %v", err)
 		return 0, err
 	}
 
-	// Retrieve the ID of the newly inserted ticket
-	ticketID, err := result.LastInsertId()
-	if err != nil {
-		log.Printf("Error retrieving last inserted ID: %v", err)
-		return 0, err
-	}
-
 	// Insert the initial conversation for the ticket
-	_, err = addInitialConversation(int(ticketID), "operator", "We will be in touch with you shortly. In the meantime please feel free to reply to this message with more details")
+	_, err = s.AddConversation(ticketID, 0, "operator", InitialConversationMessage)
 	if err != nil {
 		log.Printf("Error adding initial conversation: %v", err)
 		return 0, err
@@ -52,89 +82,46 @@ func CreateTicket(userID int, subject, issue string) (int, error) {
 	return int(ticketID), nil
 }
 
-// addInitialConversation inserts the initial conversation message for a ticket.
-func addInitialConversation(ticketID int, sender, message string) (int, error) {
-    // Context with timeout to manage database operations
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	// Prepare the SQL statement to insert the initial conversation
-	stmt := `
-        INSERT INTO conversations (ticketId, sender, message, messageSentAt)
-        VALUES (?, ?, ?, NOW())`
-
-	// Execute the SQL statement
-	result, err := db.ExecContext(ctx, stmt, ticketID, sender, message)
-	if err != nil {
-		return 0, err
-	}
-
-	// Retrieve the ID of the newly inserted conversation
-	conversationID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(conversationID), nil
-}
-
-// AddConversation adds a conversation to a ticket in the database.
-func AddConversation(ticketID int64, sender, message string) (int64, error) {
+// AddConversation adds a conversation to a ticket in the database. A senderID
+// of 0 marks an automatic message that was not sent by a user.
+func (s *SQLStore) AddConversation(ticketID int64, senderID int64, sender, message string) (int64, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Execute the SQL statement to add a conversation
-	result, err := db.ExecContext(ctx, "INSERT INTO conversations (ticketId, sender, message, messageSentAt) VALUES (?, ?, ?, ?)",
-		ticketID, sender, message, time.Now())
-	if err != nil {
-		return 0, err
-	}
-
-	return result.LastInsertId()
+	return s.insert(ctx, "INSERT INTO conversations (ticketId, senderId, sender, message, messageSentAt) VALUES (?, ?, ?, ?, ?)",
+		ticketID, nullableID(senderID), sender, message, time.Now())
 }
 
 // GetTicketsByUserID retrieves all tickets for a given user ID.
-func GetTicketsByUserID(userID int64) ([]Ticket, error) {
+func (s *SQLStore) GetTicketsByUserID(userID int64) ([]Ticket, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Query to retrieve tickets by user ID
-	rows, err := db.QueryContext(ctx, "SELECT id, userId, email, subject, issue, status, dateOpened FROM tickets WHERE userId = ?", userID)
+	rows, err := s.query(ctx, "SELECT "+ticketColumns+" FROM tickets WHERE userId = ?", userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// Iterate over the result set and populate tickets slice
-	var tickets []Ticket
-	for rows.Next() {
-		var ticket Ticket
-		err := rows.Scan(&ticket.ID, &ticket.UserID, &ticket.Email, &ticket.Subject, &ticket.Issue, &ticket.Status, &ticket.DateOpened)
-		if err != nil {
-			return nil, err
-		}
-		tickets = append(tickets, ticket)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
 
-	return tickets, nil
+	return scanTickets(rows)
 }
 
 // GetTicketByID retrieves a ticket by its ID from the database.
-func GetTicketByID(ticketID int64) (Ticket, error) {
+func (s *SQLStore) GetTicketByID(ticketID int64) (Ticket, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Query to retrieve a ticket by its ID
 	var ticket Ticket
-	err := db.QueryRowContext(ctx, "SELECT * FROM tickets WHERE id = ?", ticketID).
-		Scan(&ticket.ID, &ticket.UserID, &ticket.Email, &ticket.Subject, &ticket.Issue, &ticket.Status, &ticket.DateOpened)
+	err := s.queryRow(ctx, "SELECT "+ticketColumns+" FROM tickets WHERE id = ?", ticketID).Scan(ticketFields(&ticket)...)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return Ticket{}, ErrTicketNotFound
+		}
 		return Ticket{}, err
 	}
 
@@ -142,13 +129,13 @@ func GetTicketByID(ticketID int64) (Ticket, error) {
 }
 
 // GetConversationsByTicketID retrieves all conversations associated with a ticket ID from the database.
-func GetConversationsByTicketID(ticketID int64) ([]Conversation, error) {
+func (s *SQLStore) GetConversationsByTicketID(ticketID int64) ([]Conversation, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Query to retrieve conversations by ticket ID
-	rows, err := db.QueryContext(ctx, "SELECT * FROM conversations WHERE ticketId = ?", ticketID)
+	rows, err := s.query(ctx, "SELECT id, ticketId, sender, senderId, message, messageSentAt FROM conversations WHERE ticketId = ?", ticketID)
 	if err != nil {
 		log.Printf("Error retrieving conversations by ticket ID: %v", err)
 		return nil, err
@@ -159,7 +146,7 @@ func GetConversationsByTicketID(ticketID int64) ([]Conversation, error) {
 	var conversations []Conversation
 	for rows.Next() {
 		var conv Conversation
-		err := rows.Scan(&conv.ID, &conv.TicketID, &conv.Sender, &conv.Message, &conv.MessageSentAt)
+		err := rows.Scan(&conv.ID, &conv.TicketID, &conv.Sender, &conv.SenderID, &conv.Message, &conv.MessageSentAt)
 		if err != nil {
 			log.Printf("Error scanning conversation row: %v", err)
 			return nil, err
@@ -174,68 +161,179 @@ func GetConversationsByTicketID(ticketID int64) ([]Conversation, error) {
 	return conversations, nil
 }
 
-// CloseTicket closes a ticket by updating its status to "closed".
-func CloseTicket(ticketID int64) error {
+// UpdateTicketStatus moves a ticket from one status to another. The update
+// only applies while the ticket is still in the from status, so concurrent
+// changes are reported with ErrTicketStatusChanged. Closing a ticket records
+// when and by whom; any other status clears the closing details.
+func (s *SQLStore) UpdateTicketStatus(ticketID int64, from, to string, changedBy int64) error {
+	// Context with timeout to manage database operations
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+	if to == TicketStatusClosed {
+		result, err = s.exec(ctx, "UPDATE tickets SET status = ?, closedAt = ?, closedBy = ? WHERE id = ? AND status = ?",
+			to, time.Now(), changedBy, ticketID, from)
+	} else {
+		result, err = s.exec(ctx, "UPDATE tickets SET status = ?, closedAt = NULL, closedBy = NULL WHERE id = ? AND status = ?",
+			to, ticketID, from)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ticketAffected(result); err != ErrTicketNotFound {
+		return err
+	}
+
+	// Nothing was updated: either the ticket is gone or its status moved on
+	if _, err := s.GetUserIDByTicketID(ticketID); err != nil {
+		return err
+	}
+	return ErrTicketStatusChanged
+}
+
+// GetTicketsByAssignee retrieves the tickets assigned to an operator, most
+// urgent and oldest first. An assigneeID of 0 returns the unassigned tickets.
+func (s *SQLStore) GetTicketsByAssignee(assigneeID int64) ([]Ticket, error) {
+	// Context with timeout to manage database operations
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var rows *sql.Rows
+	var err error
+	if assigneeID == 0 {
+		rows, err = s.query(ctx, "SELECT "+ticketColumns+" FROM tickets WHERE assignedTo IS NULL ORDER BY"+ticketQueueOrder)
+	} else {
+		rows, err = s.query(ctx, "SELECT "+ticketColumns+" FROM tickets WHERE assignedTo = ? ORDER BY"+ticketQueueOrder, assigneeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return scanTickets(rows)
+}
+
+// AssignTicket moves a ticket from one assignee to another, where 0 means
+// unassigned. The update only applies while the ticket is still assigned to
+// from, so concurrent changes are reported with ErrTicketAssigneeChanged.
+func (s *SQLStore) AssignTicket(ticketID int64, from, to int64) error {
+	// Context with timeout to manage database operations
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+	if from == 0 {
+		result, err = s.exec(ctx, "UPDATE tickets SET assignedTo = ? WHERE id = ? AND assignedTo IS NULL",
+			nullableID(to), ticketID)
+	} else {
+		result, err = s.exec(ctx, "UPDATE tickets SET assignedTo = ? WHERE id = ? AND assignedTo = ?",
+			nullableID(to), ticketID, from)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ticketAffected(result); err != ErrTicketNotFound {
+		return err
+	}
+
+	// Nothing was updated: either the ticket is gone or its assignee changed
+	if _, err := s.GetUserIDByTicketID(ticketID); err != nil {
+		return err
+	}
+	return ErrTicketAssigneeChanged
+}
+
+// nullableID stores an ID of 0 as NULL
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// UpdateTicketPriority sets the priority and severity of a ticket. An empty
+// severity clears it.
+func (s *SQLStore) UpdateTicketPriority(ticketID int64, priority, severity string) error {
+	// Context with timeout to manage database operations
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var severityValue interface{}
+	if severity != "" {
+		severityValue = severity
+	}
+
+	result, err := s.exec(ctx, "UPDATE tickets SET priority = ?, severity = ? WHERE id = ?",
+		priority, severityValue, ticketID)
+	if err != nil {
+		return err
+	}
+
+	return ticketAffected(result)
+}
+
+// PurgeTicket permanently deletes a ticket together with its conversations.
+func (s *SQLStore) PurgeTicket(ticketID int64) error {
 	// Start a transaction
-	tx, err := db.Begin()
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	// Delete conversations associated with the ticket
-	_, err = tx.Exec("DELETE FROM conversations WHERE ticketId = ?", ticketID)
+	_, err = tx.Exec(s.rebind("DELETE FROM conversations WHERE ticketId = ?"), ticketID)
 	if err != nil {
 		return err
 	}
 
 	// Delete the ticket
-	_, err = tx.Exec("DELETE FROM tickets WHERE id = ?", ticketID)
+	result, err := tx.Exec(s.rebind("DELETE FROM tickets WHERE id = ?"), ticketID)
 	if err != nil {
 		return err
 	}
+	if err := ticketAffected(result); err != nil {
+		return err
+	}
 
 	// Commit the transaction
-	if err := tx.Commit(); err != nil {
+	return tx.Commit()
+}
+
+// ticketAffected returns ErrTicketNotFound when a ticket update or delete matched no rows.
+// Rows are counted as matched, not changed, on every dialect; see NewMySQLStore.
+func ticketAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
 		return err
 	}
-
+	if rowsAffected == 0 {
+		return ErrTicketNotFound
+	}
 	return nil
 }
 
-// GetUserIDByAccessTokenInt64 retrieves the user ID associated with the given access token as int64.
-func GetUserIDByAccessTokenInt64(accessToken string) (int64, error) {
+// GetUserIDByTicketID retrieves the user ID associated with a ticket from the database.
+func (s *SQLStore) GetUserIDByTicketID(ticketID int64) (int64, error) {
     // Context with timeout to manage database operations
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// Query to retrieve user ID by access token
+	// Query to retrieve user ID by ticket ID
 	var userID int64
-	query := `SELECT user_id FROM access_tokens WHERE accessJWT = ?`
+	query := "SELECT userId FROM tickets WHERE id = ?"
 
-	// Execute the query and scan the result
-	err := db.QueryRowContext(ctx, query, accessToken).Scan(&userID)
+	err := s.queryRow(ctx, query, ticketID).Scan(&userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Return 0 if no rows are found
-			return 0, nil
+			return 0, ErrTicketNotFound
 		}
 		return 0, err
 	}
 
 	return userID, nil
 }
-
-// GetUserIDByTicketID retrieves the user ID associated with a ticket from the database.
-func GetUserIDByTicketID(ticketID int64) (int64, error) {
-    // Query to retrieve user ID by ticket ID
-	var userID int64
-	query := "SELECT userId FROM tickets WHERE id = ?"
-
-	err := db.QueryRow(query, ticketID).Scan(&userID)
-	if err != nil {
-		return 0, err
-	}
-
-	return userID, nil
-}
@@ -0,0 +1,274 @@
+// two_factor.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTwoFactorNotFound is returned when a user has no authenticator, or no
+	// pending one when enrolment is confirmed
+	ErrTwoFactorNotFound = errors.New("two-factor authentication not found")
+	// ErrTotpCodeReused is returned when a TOTP code of a time step that was
+	// already used is presented again
+	ErrTotpCodeReused = errors.New("TOTP code already used")
+	// ErrTwoFactorAttemptsExceeded is returned when too many codes were
+	// entered since the last accepted one
+	ErrTwoFactorAttemptsExceeded = errors.New("too many two-factor attempts")
+	// ErrRecoveryCodeNotFound is returned when a recovery code does not exist
+	// or was already used
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+// CreateTwoFactor stores a pending authenticator for a user, replacing any
+// earlier pending one. It fails when the user already has an enabled one.
+func (s *SQLStore) CreateTwoFactor(twoFactor *TwoFactor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := s.exec(ctx, "DELETE FROM two_factor WHERE user_id = ? AND enabled_at IS NULL", twoFactor.UserID); err != nil {
+		return err
+	}
+
+	stmt := `
+        INSERT INTO two_factor (user_id, secret, created_at, last_used_step, failed_attempts)
+        VALUES (?, ?, ?, 0, 0)`
+
+	_, err := s.exec(ctx, stmt, twoFactor.UserID, twoFactor.Secret, twoFactor.CreatedAt)
+	return err
+}
+
+// GetTwoFactor retrieves the authenticator of a user, pending or enabled
+func (s *SQLStore) GetTwoFactor(userID int) (*TwoFactor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT user_id, secret, created_at, enabled_at, last_used_step, failed_attempts, last_failed_at
+        FROM two_factor
+        WHERE user_id = ?`
+
+	var twoFactor TwoFactor
+	err := s.queryRow(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.Secret,
+		&twoFactor.CreatedAt,
+		&twoFactor.EnabledAt,
+		&twoFactor.LastUsedStep,
+		&twoFactor.FailedAttempts,
+		&twoFactor.LastFailedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTwoFactorNotFound
+		}
+		return nil, err
+	}
+
+	return &twoFactor, nil
+}
+
+// EnableTwoFactor confirms the pending authenticator of a user, recording the
+// time step of the code that confirmed it, and stores their recovery codes.
+// It returns ErrTwoFactorNotFound when there is no pending authenticator.
+func (s *SQLStore) EnableTwoFactor(userID int, step int64, codeHashes []string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Start a transaction, so that the authenticator is never enabled without recovery codes
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, s.rebind("UPDATE two_factor SET enabled_at = ?, last_used_step = ? WHERE user_id = ? AND enabled_at IS NULL"),
+		at, step, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorNotFound
+	}
+
+	if err := s.replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	return tx.Commit()
+}
+
+// UseTotpStep records that the code of a time step was accepted, which also
+// clears the failed attempts. It returns ErrTotpCodeReused when a code of
+// that or a later step was already accepted.
+func (s *SQLStore) UseTotpStep(userID int, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE two_factor
+        SET last_used_step = ?, failed_attempts = 0, last_failed_at = NULL
+        WHERE user_id = ? AND last_used_step < ?`
+
+	result, err := s.exec(ctx, stmt, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTotpCodeReused
+	}
+	return nil
+}
+
+// RecordTwoFactorAttempt counts an attempt at entering a code, before the
+// code is checked, and returns the number of attempts since the last accepted
+// code. It returns ErrTwoFactorAttemptsExceeded when maxAttempts attempts were
+// already counted, so that concurrent guesses cannot exceed the limit.
+func (s *SQLStore) RecordTwoFactorAttempt(userID, maxAttempts int, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE two_factor SET failed_attempts = failed_attempts + 1, last_failed_at = ? WHERE user_id = ? AND failed_attempts < ?",
+		at, userID, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 {
+		return 0, ErrTwoFactorAttemptsExceeded
+	}
+
+	var attempts int
+	err = s.queryRow(ctx, "SELECT failed_attempts FROM two_factor WHERE user_id = ?", userID).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetTwoFactorAttempts clears the counted attempts once their lockout has
+// passed. They are only cleared while the count is still the one seen, so
+// that attempts counted meanwhile by concurrent requests are kept.
+func (s *SQLStore) ResetTwoFactorAttempts(userID, seenAttempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "UPDATE two_factor SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = ? AND failed_attempts = ?",
+		userID, seenAttempts)
+	return err
+}
+
+// DeleteTwoFactor removes the authenticator and recovery codes of a user
+func (s *SQLStore) DeleteTwoFactor(userID int) error {
+	// Start a transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(s.rebind("DELETE FROM two_factor WHERE user_id = ?"), userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorNotFound
+	}
+
+	// Commit the transaction
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user with the given
+// hashes, used or not
+func (s *SQLStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Start a transaction, so that the old codes are only removed with the new ones stored
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes replaces the recovery codes of a user within a transaction
+func (s *SQLStore) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)"), userID, codeHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code of a user as used, which also clears
+// the failed attempts. It returns ErrRecoveryCodeNotFound when the code does
+// not exist or was already used.
+func (s *SQLStore) UseRecoveryCode(userID int, codeHash string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		at, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	_, err = s.exec(ctx, "UPDATE two_factor SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = ?", userID)
+	return err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (s *SQLStore) CountRecoveryCodes(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -6,155 +6,107 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"strconv"
-	"time"
+	"sync"
 
 	"crypto/rand"
 	"math/big"
 
-	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// SetDB sets the database connection for the package
-func SetDB(database *sql.DB) {
-	db = database
-}
+var ErrUserNotFound = errors.New("user not found")
 
-// GetDB returns the current database connection
-func GetDB() *sql.DB {
-	return db
-}
+// ErrInvalidCredentials is returned when a password does not match
+var ErrInvalidCredentials = errors.New("invalid credentials")
 
-// InitializeDB initializes the database connection
-func InitializeDB(user, password, host, port, dbname string) error {
-	connectionStr := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, password, host, port, dbname)
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so that the response takes as long as for a wrong password. It is computed
+// on first use.
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
 
-	var err error
-	db, err = sql.Open("mysql", connectionStr)
-	if err != nil {
-		return err
-	}
+// ErrNoPendingEmail is returned when a user has no email change awaiting verification
+var ErrNoPendingEmail = errors.New("no pending email change")
 
-	// Check if the connection is successful
-	err = db.Ping()
+// SetPassword hashes the provided password and stores the hash on the user
+func (u *User) SetPassword(password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
 
+	u.Password = string(hashedPassword)
 	return nil
 }
 
-var ErrUserNotFound = errors.New("user not found")
-
-// Create inserts a new user into the database
-func (u *User) Create() (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	// Hash the user's password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), 12)
-	if err != nil {
-		return 0, err
-	}
+// userColumns are the columns read into a User, in scan order. The PIN and
+// refresh token columns are never read back.
+const userColumns = "id, email, first_name, last_name, password, user_active, is_admin, role, deactivated_at"
 
-	// Generate a refresh token
-	refreshJWT, err := generateRefreshToken(u.ID)
-	if err != nil {
-		return 0, err
+// userFields returns the destinations for userColumns
+func userFields(user *User) []interface{} {
+	return []interface{}{
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.UserActive,
+		&user.IsAdmin,
+		&user.Role,
+		&user.DeactivatedAt,
 	}
+}
 
-	// Generate a random 6-digit pin number for verification
-	pinNumber, err := GeneratePinNumber()
-	if err != nil {
-		return 0, err
-	}
+// CreateUser inserts a new user into the database. The password is expected
+// to be hashed already (see SetPassword), and is_admin follows the role.
+func (s *SQLStore) CreateUser(u *User) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
 
 	// Insert user data into the database
 	var newID int
 	stmt := `
-    INSERT INTO users (email, first_name, last_name, password, pin_number, user_active, is_admin, refreshJWT)
-    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+    INSERT INTO users (email, first_name, last_name, password, pin_number, user_active, is_admin, role, refreshJWT)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	res, err := db.ExecContext(ctx, stmt,
+	lastInsertID, err := s.insert(ctx, stmt,
 		u.Email,
 		u.FirstName,
 		u.LastName,
-		hashedPassword,
-		pinNumber,
+		u.Password,
+		u.PinNumber,
 		u.UserActive,
-		u.IsAdmin,
-		refreshJWT,
+		isAdminFlag(u.Role),
+		u.Role,
+		u.RefreshJWT,
 	)
 
 	if err != nil {
 		return 0, err
 	}
 
-	lastInsertID, err := res.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
 	newID = int(lastInsertID)
 
 	return newID, nil
 }
 
-// generateRefreshToken generates a refresh token for the user
-func generateRefreshToken(userID int) (string, error) {
-	// Set the expiration time for the token (you can customize this)
-	expirationTime := time.Now().Add(24 * time.Hour)
-
-	// Create the JWT claims
-	claims := &jwt.StandardClaims{
-		ExpiresAt: expirationTime.Unix(),
-		IssuedAt:  time.Now().Unix(),
-		Subject:   strconv.Itoa(userID), // Include user ID in the refresh token claims
-	}
-
-	// Create the token with the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with a secret key
-	refreshJWT := []byte(os.Getenv("JWT_REFRESH_KEY"))
-	if len(refreshJWT) == 0 {
-		log.Fatal("JWT_REFRESH_KEY is not set in the environment")
-	}
-	signedToken, err := token.SignedString(refreshJWT)
-	if err != nil {
-		return "", err
-	}
-
-	return signedToken, nil
-}
-
 // GetUserByEmail retrieves a user by email
-func GetUserByEmail(email string) (*User, error) {
+func (s *SQLStore) GetUserByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `
-		SELECT id, email, first_name, last_name, password, user_active, is_admin
-		FROM users
-		WHERE email = ?`
-
 	var user User
-	row := db.QueryRowContext(ctx, query, email)
+	row := s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email)
 
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.UserActive,
-		&user.IsAdmin,
-	)
+	err := row.Scan(userFields(&user)...)
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
 		return nil, err
 	}
 
@@ -187,9 +139,15 @@ func (u *User) PasswordMatches(providedPassword string) (bool, error) {
 }
 
 // AuthenticateUser authenticates a user based on email and password
-func AuthenticateUser(email, password string) (*User, error) {
-	user, err := GetUserByEmail(email)
+func AuthenticateUser(users UserStore, email, password string) (*User, error) {
+	user, err := users.GetUserByEmail(email)
 	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			dummyPasswordHashOnce.Do(func() {
+				dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), 12)
+			})
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		}
 		return nil, fmt.Errorf("error getting user by email: %w", err)
 	}
 
@@ -200,158 +158,163 @@ func AuthenticateUser(email, password string) (*User, error) {
 	}
 
 	if !matches {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	return user, nil
 }
 
-// CreateAccessToken creates a new access token for the user
-func CreateAccessToken(userID int, userEmail string, accessToken string) (int64, error) {
+// GetUserByID retrieves a user by ID
+func (s *SQLStore) GetUserByID(userID int) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// Calculate the expiration time (30 minutes from creation)
-	expirationTime := time.Now().Add(30 * time.Minute)
-
-	// Check if the access token already exists for the user
-	var existingAccessToken string
-	err := db.QueryRowContext(ctx, "SELECT accessJWT FROM access_tokens WHERE user_id = ?", userID).Scan(&existingAccessToken)
-
-	if err == sql.ErrNoRows {
-		// If no rows are found, insert the access token for the user with expiration time
-		result, err := db.ExecContext(ctx, "INSERT INTO access_tokens (user_id, email, accessJWT, created_at, expires_at) VALUES (?, ?, ?, NOW(), ?)", userID, userEmail, accessToken, expirationTime)
-		if err != nil {
-			return 0, err
-		}
+	var user User
+	row := s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", userID)
 
-		return result.LastInsertId()
-	} else if err != nil {
-		return 0, err
-	}
+	err := row.Scan(userFields(&user)...)
 
-	// If the access token already exists, update it
-	_, err = db.ExecContext(ctx, "UPDATE access_tokens SET accessJWT = ?, created_at = NOW(), expires_at = ? WHERE user_id = ?", accessToken, expirationTime, userID)
 	if err != nil {
-		return 0, err
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
 	}
 
-	// Return a dummy LastInsertId, as it's not relevant for updates
-	return 0, nil
+	return &user, nil
 }
 
-// GetUserByID retrieves a user by ID
-func GetUserByID(userID int) (*User, error) {
+// UpdatePassword replaces the password hash of a user (see SetPassword)
+func (s *SQLStore) UpdatePassword(userID int, passwordHash string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `
-        SELECT id, email, first_name, last_name, password, user_active, is_admin
-        FROM users
-        WHERE id = ?`
+	result, err := s.exec(ctx, "UPDATE users SET password = ? WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return err
+	}
 
-	var user User
-	row := db.QueryRowContext(ctx, query, userID)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.UserActive,
-		&user.IsAdmin,
-	)
+// UpdateUserName replaces the first and last name of a user
+func (s *SQLStore) UpdateUserName(userID int, firstName, lastName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
 
+	result, err := s.exec(ctx, "UPDATE users SET first_name = ?, last_name = ? WHERE id = ?", firstName, lastName, userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &user, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
 
-// UpdateRefreshToken updates or inserts the refresh token for a user ID
-func UpdateRefreshToken(userID int, refreshToken string) error {
+// SetUserRole changes the role of a user, and is_admin with it
+func (s *SQLStore) SetUserRole(userID int, role string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// Check if the refresh token already exists for the user
-	var existingRefreshToken string
-	err := db.QueryRowContext(ctx, "SELECT refreshJWT FROM users WHERE id = ?", userID).Scan(&existingRefreshToken)
-
-	if err == sql.ErrNoRows {
-		// If no rows are found, insert the refresh token for the user
-		_, err := db.ExecContext(ctx, "UPDATE users SET refreshJWT = ? WHERE id = ?", refreshToken, userID)
-		return err
-	} else if err != nil {
+	result, err := s.exec(ctx, "UPDATE users SET role = ?, is_admin = ? WHERE id = ?", role, isAdminFlag(role), userID)
+	if err != nil {
 		return err
 	}
 
-	// If the refresh token already exists, update it
-	_, err = db.ExecContext(ctx, "UPDATE users SET refreshJWT = ? WHERE id = ?", refreshToken, userID)
-	return err
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
 
-// Logout removes the access token and refresh token for the user, effectively logging them out
-func (u *User) Logout() error {
+// SetPendingEmail records the email address a user wants to change to. It
+// replaces any earlier pending change; an empty email withdraws it.
+func (s *SQLStore) SetPendingEmail(userID int, email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// Delete the access token entry in the access_tokens table
-	_, err := db.ExecContext(ctx, "DELETE FROM access_tokens WHERE user_id = ?", u.ID)
+	result, err := s.exec(ctx, "UPDATE users SET pending_email = ? WHERE id = ?", email, userID)
 	if err != nil {
 		return err
 	}
 
-	// Set the refreshJWT to an empty string in the users table
-	_, err = db.ExecContext(ctx, "UPDATE users SET refreshJWT = '' WHERE id = ?", u.ID)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
 	return nil
 }
 
-// GetUserIDByAccessToken retrieves the user ID associated with the given access token
-func GetUserIDByAccessToken(accessToken string) (int, error) {
+// GetPendingEmail retrieves the email address a user wants to change to. It
+// returns ErrNoPendingEmail when there is none.
+func (s *SQLStore) GetPendingEmail(userID int) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	var userID int
-	query := `SELECT user_id FROM access_tokens WHERE accessJWT = ?`
-
-	// Execute the query and scan the result
-	err := db.QueryRowContext(ctx, query, accessToken).Scan(&userID)
+	var email sql.NullString
+	err := s.queryRow(ctx, "SELECT pending_email FROM users WHERE id = ?", userID).Scan(&email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Return 0 if no rows are found
-			return 0, nil
+			return "", ErrUserNotFound
 		}
-		return 0, err
+		return "", err
+	}
+	if !email.Valid || email.String == "" {
+		return "", ErrNoPendingEmail
 	}
 
-	return userID, nil
+	return email.String, nil
 }
 
-// GetPinByEmail retrieves the PIN for a user by their email
-func GetPinByEmail(email string) (string, error) {
+// ConfirmPendingEmail makes the pending email address of a user their email
+// address. It returns ErrNoPendingEmail when email is no longer the pending
+// address, e.g. because the user asked for another change meanwhile.
+func (s *SQLStore) ConfirmPendingEmail(userID int, email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	var pin string
-	query := `
-        SELECT pin_number FROM users WHERE email = ?`
+	stmt := `
+        UPDATE users
+        SET email = pending_email, pending_email = NULL
+        WHERE id = ? AND pending_email = ?`
 
-	err := db.QueryRowContext(ctx, query, email).Scan(&pin)
+	result, err := s.exec(ctx, stmt, userID, email)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return pin, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoPendingEmail
+	}
+	return nil
 }
 
 // UserExists checks if a user already exists in the database by email
-func UserExists(email string) (bool, error) {
+func (s *SQLStore) UserExists(email string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -359,7 +322,7 @@ func UserExists(email string) (bool, error) {
 	query := `
         SELECT COUNT(*) FROM users WHERE email = ?`
 
-	err := db.QueryRowContext(ctx, query, email).Scan(&count)
+	err := s.queryRow(ctx, query, email).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -368,12 +331,12 @@ func UserExists(email string) (bool, error) {
 }
 
 // ActivateAccount activates the user account by setting UserActive to 1
-func (u *User) ActivateAccount() error {
+func (s *SQLStore) ActivateAccount(userID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	// Update the user's isActive status to 1
-	_, err := db.ExecContext(ctx, "UPDATE users SET user_active = 1 WHERE id = ?", u.ID)
+	_, err := s.exec(ctx, "UPDATE users SET user_active = 1 WHERE id = ?", userID)
 	if err != nil {
 		return err
 	}
@@ -383,12 +346,15 @@ func (u *User) ActivateAccount() error {
 
 // UpdatePinAfterVerification updates the pin_number field after PIN verification
 // and activates the user account
-func (u *User) UpdatePinAfterVerification() error {
+func (s *SQLStore) UpdatePinAfterVerification(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
 	// Prepare the SQL statement to update the pin_number and user_active fields
 	query := "UPDATE users SET pin_number = ?, user_active = 1 WHERE id = ?"
 
 	// Execute the SQL statement
-	result, err := db.Exec(query, "N/A - verified", u.ID)
+	result, err := s.exec(ctx, query, PinVerified, userID)
 	if err != nil {
 		return fmt.Errorf("error updating user data: %v", err)
 	}
@@ -406,49 +372,13 @@ func (u *User) UpdatePinAfterVerification() error {
 	return nil
 }
 
-// GetAccessTokenExpirationTime retrieves the expiration time of the access token for the given user ID.
-func GetAccessTokenExpirationTime(userID int) (time.Time, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	var expiresAt time.Time
-	err := db.QueryRowContext(ctx, "SELECT expires_at FROM access_tokens WHERE user_id = ?", userID).Scan(&expiresAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Return a zero time if no access token found for the user
-			return time.Time{}, nil
-		}
-		return time.Time{}, err
-	}
-
-	return expiresAt.UTC(), nil // Ensure expiration time is in UTC
-}
-
-// GetUserEmailByAccessToken retrieves the email associated with the provided access token.
-func GetUserEmailByAccessToken(accessToken string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	var userEmail string
-	err := db.QueryRowContext(ctx, "SELECT email FROM access_tokens WHERE accessJWT = ?", accessToken).Scan(&userEmail)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Return an empty string if no email found for the access token
-			return "", nil
-		}
-		return "", err
-	}
-
-	return userEmail, nil
-}
-
 // GetUserEmailByID retrieves the email associated with the provided user ID.
-func GetUserEmailByID(userID int) (string, error) {
+func (s *SQLStore) GetUserEmailByID(userID int) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	var userEmail string
-	err := db.QueryRowContext(ctx, "SELECT email FROM users WHERE id = ?", userID).Scan(&userEmail)
+	err := s.queryRow(ctx, "SELECT email FROM users WHERE id = ?", userID).Scan(&userEmail)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Return an empty string if no email found for the user ID
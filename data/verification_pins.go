@@ -0,0 +1,126 @@
+// verification_pins.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Purposes of a verification PIN. A user has at most one PIN per purpose.
+const (
+	PinPurposeAccount     = "account"      // Activates a newly registered account
+	PinPurposeEmailChange = "email-change" // Confirms a new email address
+)
+
+var (
+	// ErrVerificationPinNotFound is returned when a user has no PIN for the purpose
+	ErrVerificationPinNotFound = errors.New("verification PIN not found")
+	// ErrPinAttemptsExceeded is returned when a PIN was entered too many times
+	ErrPinAttemptsExceeded = errors.New("too many PIN attempts")
+)
+
+// SetPin hashes the provided PIN and stores the hash on the verification PIN.
+// PINs are hashed like passwords, as their small space makes a fast hash easy to reverse.
+func (p *VerificationPin) SetPin(pin string) error {
+	hashedPin, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	p.PinHash = string(hashedPin)
+	return nil
+}
+
+// PinMatches compares the provided PIN with the stored hash
+func (p *VerificationPin) PinMatches(pin string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(p.PinHash), []byte(pin))
+	if err == nil {
+		return true, nil
+	} else if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	} else {
+		return false, err
+	}
+}
+
+// ReplaceVerificationPin stores a new verification PIN, replacing the PIN the
+// user had for the same purpose, and returns its ID
+func (s *SQLStore) ReplaceVerificationPin(pin *VerificationPin) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := s.exec(ctx, "DELETE FROM verification_pins WHERE user_id = ? AND purpose = ?", pin.UserID, pin.Purpose); err != nil {
+		return 0, err
+	}
+
+	stmt := `
+        INSERT INTO verification_pins (user_id, purpose, pin_hash, attempts, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)`
+
+	return s.insert(ctx, stmt, pin.UserID, pin.Purpose, pin.PinHash, pin.Attempts, pin.CreatedAt, pin.ExpiresAt)
+}
+
+// GetVerificationPin retrieves the PIN of a user for the given purpose,
+// whether or not it has expired
+func (s *SQLStore) GetVerificationPin(userID int, purpose string) (*VerificationPin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT id, user_id, purpose, pin_hash, attempts, created_at, expires_at
+        FROM verification_pins
+        WHERE user_id = ? AND purpose = ?`
+
+	var pin VerificationPin
+	err := s.queryRow(ctx, query, userID, purpose).Scan(
+		&pin.ID,
+		&pin.UserID,
+		&pin.Purpose,
+		&pin.PinHash,
+		&pin.Attempts,
+		&pin.CreatedAt,
+		&pin.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVerificationPinNotFound
+		}
+		return nil, err
+	}
+
+	return &pin, nil
+}
+
+// RecordPinAttempt counts an attempt at entering a PIN. It returns
+// ErrPinAttemptsExceeded when maxAttempts attempts were already made, so that
+// concurrent guesses cannot exceed the limit.
+func (s *SQLStore) RecordPinAttempt(pinID int64, maxAttempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := s.exec(ctx, "UPDATE verification_pins SET attempts = attempts + 1 WHERE id = ? AND attempts < ?", pinID, maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPinAttemptsExceeded
+	}
+	return nil
+}
+
+// DeleteVerificationPin deletes the PIN of a user for the given purpose once it has been used
+func (s *SQLStore) DeleteVerificationPin(userID int, purpose string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := s.exec(ctx, "DELETE FROM verification_pins WHERE user_id = ? AND purpose = ?", userID, purpose)
+	return err
+}